@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// LevelAlert is the log level for security incidents, such as a honeytoken
+// passing through the proxy. It sits above slog.LevelError so it can be
+// filtered on separately from ordinary failures.
+const LevelAlert = slog.LevelError + 4
+
+// replaceLevel names LevelAlert "ALERT" in log output instead of "ERROR+4".
+func replaceLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if level, ok := a.Value.Any().(slog.Level); ok && level == LevelAlert {
+			a.Value = slog.StringValue("ALERT")
+		}
+	}
+	return a
+}
+
+// auditEntry is one line of the audit log.
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	Event     string    `json:"event"`
+	Rule      string    `json:"rule"`
+	Action    string    `json:"action"`
+	Secret    string    `json:"secret"`
+	Score     float64   `json:"score,omitempty"` // session risk, for risk events
+	Block     string    `json:"block,omitempty"`
+	ToolName  string    `json:"tool_name,omitempty"`
+	ToolUseID string    `json:"tool_use_id,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Remote    string    `json:"remote"`
+	TraceID   string    `json:"trace_id,omitempty"`
+}
+
+// auditLog appends security events to a JSON lines file.
+// With no path configured, Record is a no-op.
+type auditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newAuditLog(path string) (*auditLog, error) {
+	if path == "" {
+		return &auditLog{}, nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	return &auditLog{file: file}, nil
+}
+
+// Record appends entry to the audit log.
+func (a *auditLog) Record(entry auditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	return json.NewEncoder(a.file).Encode(entry)
+}
+
+// Close closes the file. Entries recorded after Close are dropped.
+func (a *auditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
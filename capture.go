@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// captureEntry is one line of a capture file: a scanned request body with
+// what was found in it. The body is stored either redacted or, when the
+// capture has a key, encrypted as it was received.
+type captureEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Structured bool      `json:"structured"`
+	// ConfigHash identifies the gitleaks configs the request was scanned with.
+	ConfigHash string `json:"config_hash"`
+	// Findings counts the findings per rule at capture time.
+	Findings map[string]int `json:"findings,omitempty"`
+	// Body is the redacted body, with log-only findings redacted as well.
+	Body string `json:"body,omitempty"`
+	// Sealed is the original body, encrypted with AES-256-GCM and
+	// base64-encoded with its nonce in front.
+	Sealed string `json:"sealed,omitempty"`
+}
+
+// captureLog appends scanned requests to a JSON lines file, for replaying
+// against other configs. With no path configured, Record is a no-op.
+type captureLog struct {
+	key []byte
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newCaptureLog(policy CapturePolicy) (*captureLog, error) {
+	if policy.File == "" {
+		return &captureLog{}, nil
+	}
+	var key []byte
+	if policy.KeyFile != "" {
+		var err error
+		if key, err = loadKeyFile(policy.KeyFile, "capture key"); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.OpenFile(policy.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open capture file: %w", err)
+	}
+	return &captureLog{key: key, file: file}, nil
+}
+
+// Record completes entry with the request body and appends it. original is
+// the body as received and redacted the body as forwarded.
+func (c *captureLog) Record(entry captureEntry, original, redacted []byte, findings []Finding) error {
+	c.mu.Lock()
+	closed := c.file == nil
+	c.mu.Unlock()
+	if closed {
+		return nil
+	}
+	entry.Findings = countRules(findings)
+	if c.key != nil {
+		sealed, err := seal(c.key, original)
+		if err != nil {
+			return err
+		}
+		entry.Sealed = sealed
+	} else {
+		body := string(redacted)
+		for _, f := range findings {
+			if f.Action == actionLog && f.Secret != "" {
+				body = strings.ReplaceAll(body, f.Secret, "<REDACTED_KEY>")
+			}
+		}
+		entry.Body = body
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	return json.NewEncoder(c.file).Encode(entry)
+}
+
+// Close closes the file. Entries recorded after Close are dropped.
+func (c *captureLog) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+// countRules counts findings per rule ID.
+func countRules(findings []Finding) map[string]int {
+	if len(findings) == 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, f := range findings {
+		counts[f.RuleID]++
+	}
+	return counts
+}
+
+// loadKeyFile reads a 256-bit key written as 64 hex digits, such as the
+// output of `openssl rand -hex 32`. name describes the key in errors.
+func loadKeyFile(path, name string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("%s must be 64 hex digits", name)
+	}
+	return key, nil
+}
+
+func seal(key, plaintext []byte) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func unseal(key []byte, sealed string) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("decode sealed body: %w", err)
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("sealed body is truncated")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt sealed body: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/zricethezav/gitleaks/v8/detect"
+)
+
+// configCheck is the outcome of checking a layered gitleaks config.
+type configCheck struct {
+	Layers []string
+	Rules  int
+	// Errors stop the config from loading.
+	Errors   []string
+	Warnings []string
+	// Examples is how many examples were run, and Skipped the rules they
+	// were for that the config does not have.
+	Examples int
+	Skipped  []string
+	Failures []selfTestFailure
+}
+
+// checkGitleaksConfig loads the configs at paths the way the proxy does, but
+// collects every problem instead of stopping at the first, then runs the
+// examples against the result if it loads.
+func checkGitleaksConfig(paths []string, overlay string, examples []ruleExample) (configCheck, error) {
+	layers, _, err := readGitleaksLayers(paths, overlay)
+	if err != nil {
+		return configCheck{}, err
+	}
+	merged, cfg := mergeGitleaksLayers(layers)
+	check := configCheck{Layers: cfg.Layers, Rules: len(merged.Rules)}
+	errs, warnings := lintGitleaksConfig(layers, merged, cfg)
+	check.Errors = errs
+	check.Warnings = slices.Concat(cfg.Warnings, warnings)
+	if len(merged.Rules) == 0 {
+		check.Errors = append(check.Errors, "config has no rules")
+	}
+	if len(check.Errors) > 0 {
+		return check, nil
+	}
+
+	translated, err := merged.Translate()
+	if err != nil {
+		check.Errors = append(check.Errors, err.Error())
+		return check, nil
+	}
+	for _, example := range examples {
+		check.Examples += len(example.Match) + len(example.NoMatch)
+	}
+	check.Failures, check.Skipped = selfTest(detect.NewDetector(translated), examples)
+	return check, nil
+}
+
+// runConfig implements `claude-gitleaks config check`.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		return errors.New("usage: claude-gitleaks config check [-config file]... [-policy file] [-examples file]...")
+	}
+
+	flags := flag.NewFlagSet("config check", flag.ContinueOnError)
+	var configPaths, examplePaths stringList
+	flags.Var(&configPaths, "config", "path to gitleaks config file, repeat to layer configs in order (uses default config if not specified)")
+	policyPath := flags.String("policy", "", "path to proxy policy file, for its self_test.examples and feedback overlay")
+	flags.Var(&examplePaths, "examples", "path to a file of extra rule examples, may be repeated")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	policy, err := loadPolicy(*policyPath)
+	if err != nil {
+		return fmt.Errorf("load policy from %s: %w", *policyPath, err)
+	}
+	examples, err := loadRuleExamples(slices.Concat(policy.SelfTest.Examples, examplePaths))
+	if err != nil {
+		return err
+	}
+	check, err := checkGitleaksConfig(configPaths, policy.Feedback.Config, examples)
+	if err != nil {
+		return err
+	}
+
+	printConfigCheck(os.Stdout, check)
+	if len(check.Errors) > 0 || len(check.Failures) > 0 {
+		return fmt.Errorf("%d errors, %d self-test failures", len(check.Errors), len(check.Failures))
+	}
+	return nil
+}
+
+func printConfigCheck(w io.Writer, check configCheck) {
+	fmt.Fprintf(w, "layers: %v\n", check.Layers)
+	fmt.Fprintf(w, "rules: %d\n", check.Rules)
+	for _, e := range check.Errors {
+		fmt.Fprintf(w, "error: %s\n", e)
+	}
+	for _, warning := range check.Warnings {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+	if len(check.Errors) > 0 {
+		fmt.Fprintln(w, "self-test: not run")
+		return
+	}
+	for _, failure := range check.Failures {
+		fmt.Fprintf(w, "fail: %s\n", failure)
+	}
+	slices.Sort(check.Skipped)
+	if skipped := slices.Compact(check.Skipped); len(skipped) > 0 {
+		fmt.Fprintf(w, "self-test: skipped rules not in the config: %v\n", skipped)
+	}
+	fmt.Fprintf(w, "self-test: %d examples, %d failures\n", check.Examples, len(check.Failures))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckGitleaksConfig(t *testing.T) {
+	dir := t.TempDir()
+	project := writeLayer(t, dir, "project.toml", `
+[[rules]]
+id = "acme-token"
+regex = '''acme_live_[a-z0-9]{8}\b'''
+keywords = ["acme_live_"]
+
+[[rules]]
+id = "broken-token"
+regex = '''broken_(['''
+keywords = ["broken_"]
+
+[[rules]]
+id = "chatty-token"
+regex = '''chatty_[a-z]{8}'''
+entropy = 1.0
+
+[[rules]]
+id = "paired-token"
+regex = '''paired_[a-z]{8}'''
+keywords = ["paired_"]
+[[rules.required]]
+id = "never-defined"
+`)
+	check, err := checkGitleaksConfig([]string{project}, "", nil)
+	if err != nil {
+		t.Fatalf("checkGitleaksConfig: %v", err)
+	}
+	wantErrs := []string{
+		"rule broken-token (" + project + "): invalid pattern",
+		"rule paired-token (" + project + `): required rule "never-defined" does not exist`,
+	}
+	if len(check.Errors) != len(wantErrs) {
+		t.Fatalf("errors = %q, want %d", check.Errors, len(wantErrs))
+	}
+	for i, want := range wantErrs {
+		if !strings.Contains(check.Errors[i], want) {
+			t.Errorf("errors[%d] = %q, want it to contain %q", i, check.Errors[i], want)
+		}
+	}
+	for _, want := range []string{
+		"rule chatty-token (" + project + "): no keywords",
+		"rule chatty-token (" + project + "): entropy 1 is low",
+	} {
+		if !containsSubstring(check.Warnings, want) {
+			t.Errorf("warnings = %q, want one containing %q", check.Warnings, want)
+		}
+	}
+	// the examples only run against a config that loads
+	if check.Examples != 0 || check.Failures != nil {
+		t.Errorf("examples ran against a broken config: %+v", check)
+	}
+
+	fixed := writeLayer(t, dir, "fixed.toml", `
+[[rules]]
+id = "acme-token"
+regex = '''acme_live_[a-z0-9]{8}\b'''
+keywords = ["acme_live_"]
+`)
+	examples := []ruleExample{{Rule: "acme-token", Match: []string{"acme_live_x7kq2vmn"}, NoMatch: []string{"acme_live_short"}}}
+	check, err = checkGitleaksConfig([]string{fixed}, "", examples)
+	if err != nil {
+		t.Fatalf("checkGitleaksConfig: %v", err)
+	}
+	if len(check.Errors) > 0 || check.Examples != 2 || len(check.Failures) > 0 {
+		t.Errorf("check = %+v, want 2 passing examples and no errors", check)
+	}
+	if check.Rules != 1 {
+		t.Errorf("rules = %d, want 1", check.Rules)
+	}
+}
+
+func containsSubstring(list []string, substr string) bool {
+	for _, s := range list {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
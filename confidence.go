@@ -0,0 +1,181 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// contextWindow is how much text before a secret is looked at for hints
+// about what it is.
+const contextWindow = 40
+
+var (
+	uuidPattern    = regexp.MustCompile(`^(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	hexHashPattern = regexp.MustCompile(`^(?i)(?:[0-9a-f]{32}|[0-9a-f]{40}|[0-9a-f]{64}|[0-9a-f]{128})$`)
+	// getUserToken, MAX_RETRY_COUNT, user.profile.name
+	identifierPattern = regexp.MustCompile(`^[A-Za-z][a-z]*(?:[A-Z._-]?[A-Za-z][a-z]*)*$`)
+	pathPattern       = regexp.MustCompile(`^(?:~|\.{1,2})?(?:[/\\][\w.@-]+){2,}[/\\]?$`)
+
+	// words before a secret that make it more or less likely to be real
+	secretHints  = regexp.MustCompile(`(?i)(?:passw|secret|token|api[_-]?key|auth|bearer|credential|private)`)
+	exampleHints = regexp.MustCompile(`(?i)(?:example|sample|dummy|fake|placeholder|test|mock|changeme|your[_-])`)
+	digestHints  = regexp.MustCompile(`(?i)(?:sha\d*|md5|hash|digest|checksum|commit|integrity|uuid|etag)`)
+)
+
+// dictionaryWords are common English and programming words. Real secrets
+// rarely contain them; identifiers, prose and placeholders usually do.
+var dictionaryWords = []string{
+	"access", "account", "admin", "allow", "apple", "application", "auth", "back",
+	"base", "blue", "build", "cache", "change", "check", "client", "cloud",
+	"code", "config", "connect", "content", "count", "data", "debug", "default",
+	"demo", "deploy", "dev", "dummy", "error", "event", "example", "false",
+	"field", "file", "green", "hello", "local", "login", "main", "master",
+	"message", "name", "null", "number", "open", "pass", "password", "path",
+	"port", "prod", "public", "query", "random", "read", "red", "request",
+	"response", "retry", "root", "sample", "secret", "server", "service",
+	"session", "stage", "start", "string", "super", "system", "table", "test",
+	"text", "time", "token", "true", "type", "update", "user", "value",
+	"welcome", "world", "write",
+}
+
+// scoreConfidence estimates how likely secret is to be a real credential
+// rather than an identifier, path, digest or placeholder, from 0 to 1.
+// before is the text leading up to the secret.
+func scoreConfidence(secret, before string) float64 {
+	score := 0.5
+	n := len(secret)
+
+	// entropy relative to the most a string of this length could have
+	if n > 1 {
+		maxEntropy := math.Log2(float64(min(n, 64)))
+		score += (shannonEntropy(secret)/maxEntropy - 0.6) * 0.6
+	}
+	score += float64(charClasses(secret)-2) * 0.1
+	score -= dictionaryRatio(secret) * 0.5
+	if n < 8 {
+		score -= 0.2
+	}
+
+	switch {
+	case uuidPattern.MatchString(secret):
+		score -= 0.4
+	case hexHashPattern.MatchString(secret):
+		score -= 0.3
+	case pathPattern.MatchString(secret):
+		score -= 0.4
+	case identifierPattern.MatchString(secret):
+		score -= 0.3
+	}
+
+	if secretHints.MatchString(before) {
+		score += 0.15
+	}
+	if exampleHints.MatchString(before) || exampleHints.MatchString(secret) {
+		score -= 0.25
+	}
+	if digestHints.MatchString(before) {
+		score -= 0.2
+	}
+
+	// never 0, which means not scored
+	return math.Round(min(max(score, 0.01), 1)*100) / 100
+}
+
+// textBefore returns up to contextWindow bytes of text before the first
+// occurrence of secret.
+func textBefore(text, secret string) string {
+	i := strings.Index(text, secret)
+	if i < 0 {
+		return ""
+	}
+	return text[max(0, i-contextWindow):i]
+}
+
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+	total := float64(len([]rune(s)))
+	entropy := 0.0
+	for _, c := range counts {
+		p := float64(c) / total
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// charClasses counts the classes present in s: lower case, upper case,
+// digits and everything else.
+func charClasses(s string) int {
+	var lower, upper, digit, other bool
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			classes++
+		}
+	}
+	return classes
+}
+
+// dictionaryRatio is the fraction of s covered by dictionary words.
+func dictionaryRatio(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	lower := strings.ToLower(s)
+	covered := make([]bool, len(lower))
+	for _, word := range dictionaryWords {
+		for i := 0; ; {
+			j := strings.Index(lower[i:], word)
+			if j < 0 {
+				break
+			}
+			for k := i + j; k < i+j+len(word); k++ {
+				covered[k] = true
+			}
+			i += j + 1
+		}
+	}
+	n := 0
+	for _, c := range covered {
+		if c {
+			n++
+		}
+	}
+	return float64(n) / float64(len(lower))
+}
+
+// applyConfidence scores the findings that their detector did not already
+// vouch for, and downgrades those below their rule's threshold to log-only.
+// Findings with an action set by their rule or tool policy keep it: the
+// score only decides for findings left to the default action.
+func (s *Scanner) applyConfidence(text string, findings []Finding) []Finding {
+	policy := s.policy.Confidence
+	if !policy.Enabled {
+		return findings
+	}
+	for i, f := range findings {
+		if f.Confidence == 0 {
+			findings[i].Confidence = scoreConfidence(f.Secret, textBefore(text, f.Secret))
+		}
+		if f.Action == "" && findings[i].Confidence < policy.ThresholdFor(f.RuleID) {
+			findings[i].Action = actionLog
+		}
+	}
+	return findings
+}
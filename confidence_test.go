@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestScoreConfidence(t *testing.T) {
+	// each pair is ordered: the first looks more like a real secret
+	tests := []struct {
+		name                 string
+		likely, unlikely     string
+		likelyBefore, before string
+	}{
+		{"random over identifier", "q8Zr2Lw9XkP4vT7m", "getUserTokenValue", "", ""},
+		{"random over uuid", "q8Zr2Lw9XkP4vT7mN3bY", "123e4567-e89b-12d3-a456-426614174000", "", ""},
+		{"random over path", "q8Zr2Lw9XkP4vT7mN3bY", "/usr/local/share/config", "", ""},
+		{"random over placeholder", "q8Zr2Lw9XkP4vT7m", "your-password-here", "", ""},
+		{"secret hint over digest hint", "a1b2c3d4e5f6a7b8c9d0", "a1b2c3d4e5f6a7b8c9d0", "password = ", "sha256: "},
+		{"plain over example hint", "q8Zr2Lw9XkP4vT7m", "q8Zr2Lw9XkP4vT7m", "key = ", "example key = "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			likely := scoreConfidence(tt.likely, tt.likelyBefore)
+			unlikely := scoreConfidence(tt.unlikely, tt.before)
+			if likely <= unlikely {
+				t.Errorf("score(%q) = %v, not above score(%q) = %v", tt.likely, likely, tt.unlikely, unlikely)
+			}
+		})
+	}
+
+	for _, secret := range []string{"", "a", "aaaaaaaa", "password", "q8Zr2Lw9XkP4vT7m!@#$%^&*()"} {
+		if score := scoreConfidence(secret, ""); score <= 0 || score > 1 {
+			t.Errorf("score(%q) = %v, want in (0, 1]", secret, score)
+		}
+	}
+}
+
+func TestTextBefore(t *testing.T) {
+	text := "a long preamble that runs past the context window; token=s3cr3t and s3cr3t"
+	got := textBefore(text, "s3cr3t")
+	if len(got) != contextWindow || got[len(got)-6:] != "token=" {
+		t.Errorf("textBefore = %q", got)
+	}
+	if got := textBefore("x=s3cr3t", "s3cr3t"); got != "x=" {
+		t.Errorf("textBefore = %q, want x=", got)
+	}
+	if got := textBefore(text, "missing"); got != "" {
+		t.Errorf("textBefore = %q, want empty", got)
+	}
+}
+
+func TestApplyConfidence(t *testing.T) {
+	policy := Policy{Confidence: ConfidencePolicy{
+		Enabled:    true,
+		Threshold:  0.5,
+		Thresholds: map[string]float64{"strict-rule": 1},
+	}}
+	s := &Scanner{policy: policy}
+
+	findings := s.applyConfidence("", []Finding{
+		{RuleID: "generic", Secret: "getUserTokenValue"},
+		{RuleID: "generic", Secret: "q8Zr2Lw9XkP4vT7mN3bY"},
+		{RuleID: "generic", Secret: "getUserTokenValue", Action: actionReject},
+		{RuleID: "generic", Secret: "getUserTokenValue", Action: actionRedact},
+		{RuleID: "strict-rule", Secret: "q8Zr2Lw9XkP4vT7mN3bY"},
+		{RuleID: "vouched", Secret: "getUserTokenValue", Confidence: 1},
+	})
+	want := []string{actionLog, "", actionReject, actionRedact, actionLog, ""}
+	for i, f := range findings {
+		if f.Confidence == 0 {
+			t.Errorf("finding %d was not scored", i)
+		}
+		if f.Action != want[i] {
+			t.Errorf("finding %d: action = %q, want %q", i, f.Action, want[i])
+		}
+	}
+	if findings[5].Confidence != 1 {
+		t.Errorf("vouched confidence = %v, want 1", findings[5].Confidence)
+	}
+
+	s.policy.Confidence.Enabled = false
+	off := s.applyConfidence("", []Finding{{RuleID: "generic", Secret: "getUserTokenValue"}})
+	if off[0].Confidence != 0 || off[0].Action != "" {
+		t.Errorf("disabled scorer changed the finding: %+v", off[0])
+	}
+}
+
+func TestConfidenceKeepsExplicitActions(t *testing.T) {
+	policy := defaultTestPolicy(t)
+	// every finding scores below this
+	policy.Confidence = ConfidencePolicy{Enabled: true, Threshold: 2}
+	policy.Actions = map[string]string{"github-pat": actionReject}
+	scanner := newTestScanner(t, policy)
+
+	findings := scanner.Scan(t.Context(), "token: "+testToken, Location{Block: "text"}).Findings
+	if len(findings) == 0 {
+		t.Fatal("no findings")
+	}
+	for _, f := range findings {
+		if f.RuleID == "github-pat" && f.Action != actionReject {
+			t.Errorf("github-pat action = %q, want reject despite confidence %v", f.Action, f.Confidence)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// configFileRuleID is reported for values redacted because of their key name
+// rather than a gitleaks rule.
+const configFileRuleID = "config-sensitive-key"
+
+var (
+	// Claude Code's Read tool prefixes each line with its number, e.g. "    12→KEY=value"
+	lineNumberPrefix = regexp.MustCompile(`^\s*\d+(?:→|\t)`)
+	// KEY=value in .env and ini style files, with an optional `export`, and
+	// //registry.npmjs.org/:_authToken=value in .npmrc
+	assignmentLine = regexp.MustCompile(`^\s*(?:export\s+)?([^\s=#;]+)\s*=\s*(.*?)\s*$`)
+	// key: value in YAML, including list items
+	yamlLine = regexp.MustCompile(`^\s*(?:-\s+)?["']?([\w./-]+)["']?\s*:\s+(.*?)\s*$`)
+)
+
+// configFileDetector recognises structured config files (.env, YAML, JSON,
+// .npmrc) in tool results and reports the values of keys whose names look
+// sensitive, whatever the value's entropy. Only the value is reported, so
+// the key stays readable after redaction.
+type configFileDetector struct {
+	sensitiveKeys []*regexp.Regexp
+}
+
+func newConfigFileDetector(patterns []string) (*configFileDetector, error) {
+	d := &configFileDetector{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("compile sensitive key pattern %q: %w", p, err)
+		}
+		d.sensitiveKeys = append(d.sensitiveKeys, re)
+	}
+	return d, nil
+}
+
+// Detect returns a finding for every sensitive value in text.
+func (d *configFileDetector) Detect(text string) []Finding {
+	if len(d.sensitiveKeys) == 0 {
+		return nil
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = lineNumberPrefix.ReplaceAllString(line, "")
+	}
+	content := strings.Join(lines, "\n")
+
+	// JSON documents: appsettings.json, ~/.docker/config.json, terraform.tfstate
+	trimmed := strings.TrimSpace(content)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var doc any
+		if err := json.Unmarshal([]byte(trimmed), &doc); err == nil {
+			var findings []Finding
+			d.walkJSON("", doc, &findings)
+			return findings
+		}
+	}
+
+	var findings []Finding
+	entries, nonEmpty := 0, 0
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+		nonEmpty++
+
+		m := assignmentLine.FindStringSubmatch(line)
+		if m == nil {
+			m = yamlLine.FindStringSubmatch(line)
+		}
+		if m == nil {
+			continue
+		}
+		entries++
+
+		if value := unquote(m[2]); d.isSensitive(m[1], value) {
+			findings = append(findings, Finding{RuleID: configFileRuleID, Secret: value})
+		}
+	}
+
+	// Only treat the text as a config file if most of it is key/value pairs,
+	// otherwise `token = getToken()` in source code would be redacted too
+	if entries*2 < nonEmpty {
+		return nil
+	}
+
+	return findings
+}
+
+func (d *configFileDetector) walkJSON(key string, node any, findings *[]Finding) {
+	switch v := node.(type) {
+	case map[string]any:
+		for k, child := range v {
+			d.walkJSON(k, child, findings)
+		}
+	case []any:
+		for _, child := range v {
+			d.walkJSON(key, child, findings)
+		}
+	case string:
+		if d.isSensitive(key, v) {
+			*findings = append(*findings, Finding{RuleID: configFileRuleID, Secret: v})
+		}
+	}
+}
+
+func (d *configFileDetector) isSensitive(key, value string) bool {
+	if !looksLikeSecretValue(value) {
+		return false
+	}
+	for _, re := range d.sensitiveKeys {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksLikeSecretValue filters out values that are never secrets but would do
+// a lot of collateral damage when replaced throughout the text, such as
+// numbers, booleans and variable references.
+func looksLikeSecretValue(value string) bool {
+	if len(value) < 3 {
+		return false
+	}
+	switch strings.ToLower(value) {
+	case "true", "false", "null", "none", "yes", "no":
+		return false
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return false
+	}
+	// ${VAR}, {{ .Values.x }}, YAML block scalars, anchors and nested objects
+	for _, prefix := range []string{"${", "{{", "|", ">", "&", "*", "{", "["} {
+		if strings.HasPrefix(value, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// unquote strips matching surrounding quotes and trailing inline comments.
+func unquote(value string) string {
+	if len(value) >= 2 {
+		if q := value[0]; (q == '"' || q == '\'') && value[len(value)-1] == q {
+			return value[1 : len(value)-1]
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
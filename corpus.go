@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+)
+
+// corpusAttempts is how many random samples are tried per rule before giving
+// up on it.
+const corpusAttempts = 50
+
+// corpusCase is one synthetic secret, embedded in a request body the way
+// Claude Code would send it.
+type corpusCase struct {
+	RuleID string `json:"rule"`
+	// Secret is what the baseline config redacted.
+	Secret string `json:"secret"`
+	// Template names the kind of request the secret is in.
+	Template string `json:"template"`
+	// Source is "example" for the built-in rule examples and "regex" for a
+	// string generated from the rule's regex.
+	Source string          `json:"source"`
+	Body   json.RawMessage `json:"body"`
+}
+
+// corpusTemplate embeds a line of text in a request body.
+type corpusTemplate struct {
+	name  string
+	build func(line string) map[string]any
+}
+
+// corpusTemplates are the places secrets turn up in Claude Code traffic: a
+// pasted error, a file read, command output and a file the model writes.
+var corpusTemplates = []corpusTemplate{
+	{"user-text", func(line string) map[string]any {
+		return corpusRequest(
+			userMessage(textBlock("This fails with a 401, can you see why?\n\n```\n" + line + "\n```")),
+		)
+	}},
+	{"read-result", func(line string) map[string]any {
+		return corpusRequest(
+			userMessage(textBlock("Check the local settings")),
+			assistantMessage(toolUseBlock("toolu_01", "Read", map[string]any{"file_path": "/home/dev/app/config/local.conf"})),
+			userMessage(toolResultBlock("toolu_01", "     1\t# local settings\n     2\t"+line+"\n     3\t")),
+		)
+	}},
+	{"bash-result", func(line string) map[string]any {
+		return corpusRequest(
+			userMessage(textBlock("What is deployed?")),
+			assistantMessage(toolUseBlock("toolu_02", "Bash", map[string]any{"command": "cat deploy/notes.txt", "description": "Show deploy notes"})),
+			userMessage(toolResultBlock("toolu_02", "deploy notes\n"+line+"\n")),
+		)
+	}},
+	{"write-input", func(line string) map[string]any {
+		return corpusRequest(
+			userMessage(textBlock("Add the settings file")),
+			assistantMessage(toolUseBlock("toolu_03", "Write", map[string]any{"file_path": "/home/dev/app/settings.txt", "content": "# settings\n" + line + "\n"})),
+			userMessage(toolResultBlock("toolu_03", "File created successfully at: /home/dev/app/settings.txt")),
+		)
+	}},
+}
+
+func corpusRequest(messages ...map[string]any) map[string]any {
+	return map[string]any{
+		"model":      "claude-sonnet-4-5",
+		"max_tokens": 4096,
+		"system":     "You are Claude Code, a CLI for software engineering.",
+		"metadata":   map[string]any{"user_id": "corpus"},
+		"messages":   messages,
+	}
+}
+
+func userMessage(blocks ...map[string]any) map[string]any {
+	return map[string]any{"role": "user", "content": blocks}
+}
+
+func assistantMessage(blocks ...map[string]any) map[string]any {
+	return map[string]any{"role": "assistant", "content": blocks}
+}
+
+func textBlock(text string) map[string]any {
+	return map[string]any{"type": "text", "text": text}
+}
+
+func toolUseBlock(id, name string, input map[string]any) map[string]any {
+	return map[string]any{"type": "tool_use", "id": id, "name": name, "input": input}
+}
+
+func toolResultBlock(id, content string) map[string]any {
+	return map[string]any{"type": "tool_result", "tool_use_id": id, "content": content}
+}
+
+// generateCorpus builds up to perRule cases for every gitleaks rule of the
+// scanner, from the rule's examples first and then from its regex. A case is
+// kept only if the scanner itself finds the secret with that rule and
+// redacts it, so the corpus records what the config catches.
+func generateCorpus(ctx context.Context, scanner *Scanner, examples []ruleExample, perRule int, seed uint64) ([]corpusCase, []string) {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	sampler := regexSampler{rng: rng}
+	cfg := scanner.gitleaks.Load().rules.Config
+
+	var cases []corpusCase
+	var missing []string
+	for _, rule := range cfg.GetOrderedRules() {
+		if rule.SkipReport {
+			continue
+		}
+		found := 0
+		try := func(line, source string) {
+			template := corpusTemplates[rng.IntN(len(corpusTemplates))]
+			if c, ok := corpusCaseFor(ctx, scanner, rule.RuleID, line, source, template); ok {
+				cases = append(cases, c)
+				found++
+			}
+		}
+
+		for _, example := range examples {
+			if example.Rule != rule.RuleID {
+				continue
+			}
+			for _, line := range example.Match {
+				if found < perRule {
+					try(line, "example")
+				}
+			}
+		}
+		if rule.Regex != nil {
+			for range corpusAttempts {
+				if found >= perRule {
+					break
+				}
+				line, err := sampler.Sample(rule.Regex.String())
+				if err != nil {
+					break
+				}
+				try(line, "regex")
+			}
+		}
+		if found == 0 {
+			missing = append(missing, rule.RuleID)
+		}
+	}
+	return cases, missing
+}
+
+// corpusCaseFor embeds line in template and keeps it if scanner redacts a
+// finding of ruleID from it.
+func corpusCaseFor(ctx context.Context, scanner *Scanner, ruleID, line, source string, template corpusTemplate) (corpusCase, bool) {
+	body, err := json.Marshal(template.build(line))
+	if err != nil {
+		return corpusCase{}, false
+	}
+	result, redacted, err := scanner.ScanAndReplaceRequestBody(ctx, body, "<REDACTED_KEY>")
+	if err != nil {
+		return corpusCase{}, false
+	}
+	for _, f := range result.Findings {
+		if f.RuleID == ruleID && f.Action != actionLog && !survived(redacted, f.Secret) {
+			return corpusCase{RuleID: ruleID, Secret: f.Secret, Template: template.name, Source: source, Body: body}, true
+		}
+	}
+	return corpusCase{}, false
+}
+
+// survived reports whether secret is still in a redacted body, as it is or
+// as JSON encodes it.
+func survived(body []byte, secret string) bool {
+	encoded, _ := json.Marshal(secret)
+	return strings.Contains(string(body), secret) || strings.Contains(string(body), strings.Trim(string(encoded), `"`))
+}
+
+// ruleRecall is how many of a rule's cases a config caught.
+type ruleRecall struct {
+	RuleID string  `json:"rule"`
+	Cases  int     `json:"cases"`
+	Found  int     `json:"found"`
+	Recall float64 `json:"recall"`
+}
+
+// corpusResult is the outcome of running a corpus through a config.
+type corpusResult struct {
+	Cases int          `json:"cases"`
+	Rules []ruleRecall `json:"rules"`
+	// Missed are the cases whose rule did not fire, Survived those whose
+	// secret was left in the redacted body, whichever rule fired.
+	Missed   []corpusCase `json:"missed"`
+	Survived []corpusCase `json:"survived"`
+}
+
+// testCorpus runs every case through scanner.
+func testCorpus(ctx context.Context, scanner *Scanner, cases []corpusCase) corpusResult {
+	result := corpusResult{Cases: len(cases), Missed: []corpusCase{}, Survived: []corpusCase{}}
+	recall := make(map[string]*ruleRecall)
+	var order []string
+	for _, c := range cases {
+		r, ok := recall[c.RuleID]
+		if !ok {
+			r = &ruleRecall{RuleID: c.RuleID}
+			recall[c.RuleID] = r
+			order = append(order, c.RuleID)
+		}
+		r.Cases++
+
+		scan, redacted, err := scanner.ScanAndReplaceRequestBody(ctx, c.Body, "<REDACTED_KEY>")
+		if err != nil {
+			redacted = c.Body
+		}
+		if slices.ContainsFunc(scan.Findings, func(f Finding) bool { return f.RuleID == c.RuleID }) {
+			r.Found++
+		} else {
+			result.Missed = append(result.Missed, c)
+		}
+		if survived(redacted, c.Secret) {
+			result.Survived = append(result.Survived, c)
+		}
+	}
+	for _, id := range order {
+		r := recall[id]
+		r.Recall = float64(r.Found) / float64(r.Cases)
+		result.Rules = append(result.Rules, *r)
+	}
+	return result
+}
+
+// runCorpus implements `claude-gitleaks corpus generate` and `corpus test`.
+func runCorpus(args []string) error {
+	usage := errors.New("usage: claude-gitleaks corpus generate|test [flags]")
+	if len(args) == 0 {
+		return usage
+	}
+
+	flags := flag.NewFlagSet("corpus "+args[0], flag.ContinueOnError)
+	var configPaths stringList
+	flags.Var(&configPaths, "config", "path to gitleaks config file, repeat to layer configs in order (uses default config if not specified)")
+	policyPath := flags.String("policy", "", "path to proxy policy file (uses default policy if not specified)")
+	debug := flags.Bool("debug", false, "enable debug logging")
+
+	switch args[0] {
+	case "generate":
+		perRule := flags.Int("per-rule", 3, "how many secrets to generate per rule")
+		seed := flags.Uint64("seed", 1, "random seed, the same seed and config give the same corpus")
+		out := flags.String("o", "-", "file to write the corpus to")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		scanner, err := corpusScanner(configPaths, *policyPath, *debug)
+		if err != nil {
+			return err
+		}
+		defer scanner.Close()
+		examples, err := loadRuleExamples(scanner.policy.SelfTest.Examples)
+		if err != nil {
+			return err
+		}
+
+		cases, missing := generateCorpus(context.Background(), scanner, examples, *perRule, *seed)
+		w := io.Writer(os.Stdout)
+		if *out != "-" {
+			file, err := os.Create(*out)
+			if err != nil {
+				return fmt.Errorf("create corpus: %w", err)
+			}
+			defer file.Close()
+			w = file
+		}
+		enc := json.NewEncoder(w)
+		for _, c := range cases {
+			if err := enc.Encode(c); err != nil {
+				return fmt.Errorf("write corpus: %w", err)
+			}
+		}
+		rules := len(scanner.gitleaks.Load().rules.Config.Rules)
+		fmt.Fprintf(os.Stderr, "generated %d cases for %d of %d rules\n", len(cases), rules-len(missing), rules)
+		if len(missing) > 0 {
+			fmt.Fprintf(os.Stderr, "no case for: %s\n", strings.Join(missing, ", "))
+		}
+		return nil
+
+	case "test":
+		format := flags.String("format", "text", "output format: text or json")
+		minRecall := flags.Float64("min-recall", 1, "exit with an error if any rule's recall is below this")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New("usage: claude-gitleaks corpus test [flags] corpus.jsonl")
+		}
+		if *format != "text" && *format != "json" {
+			return fmt.Errorf("-format must be text or json, got %q", *format)
+		}
+		cases, err := readCorpus(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		scanner, err := corpusScanner(configPaths, *policyPath, *debug)
+		if err != nil {
+			return err
+		}
+		defer scanner.Close()
+
+		result := testCorpus(context.Background(), scanner, cases)
+		if *format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(result)
+		} else {
+			err = writeCorpusText(os.Stdout, result)
+		}
+		if err != nil {
+			return err
+		}
+
+		low := 0
+		for _, r := range result.Rules {
+			if r.Recall < *minRecall {
+				low++
+			}
+		}
+		if low > 0 || len(result.Survived) > 0 {
+			return fmt.Errorf("%d rules below recall %.2f, %d secrets survived redaction", low, *minRecall, len(result.Survived))
+		}
+		return nil
+
+	default:
+		return usage
+	}
+}
+
+func corpusScanner(configPaths []string, policyPath string, debug bool) (*Scanner, error) {
+	policy, err := loadPolicy(policyPath)
+	if err != nil {
+		return nil, fmt.Errorf("load policy from %s: %w", policyPath, err)
+	}
+	scanner, err := NewScanner(configPaths, policy, commandLogger(debug))
+	if err != nil {
+		return nil, fmt.Errorf("create scanner: %w", err)
+	}
+	return scanner, nil
+}
+
+func readCorpus(path string) ([]corpusCase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open corpus: %w", err)
+	}
+	defer file.Close()
+
+	var cases []corpusCase
+	lines := bufio.NewScanner(file)
+	lines.Buffer(nil, maxCaptureLine)
+	for n := 1; lines.Scan(); n++ {
+		var c corpusCase
+		if err := json.Unmarshal(lines.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("corpus line %d: %w", n, err)
+		}
+		cases = append(cases, c)
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("read corpus: %w", err)
+	}
+	return cases, nil
+}
+
+func writeCorpusText(w io.Writer, result corpusResult) error {
+	found := 0
+	for _, r := range result.Rules {
+		found += r.Found
+	}
+	fmt.Fprintf(w, "%d cases, %d rules, %d found\n", result.Cases, len(result.Rules), found)
+
+	fmt.Fprintln(w, "\nrules below full recall:")
+	below := 0
+	for _, r := range result.Rules {
+		if r.Found < r.Cases {
+			fmt.Fprintf(w, "  %-40s %d/%d  recall %.2f\n", r.RuleID, r.Found, r.Cases, r.Recall)
+			below++
+		}
+	}
+	if below == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+
+	fmt.Fprintln(w, "\nsecrets that survived redaction:")
+	if len(result.Survived) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, c := range result.Survived {
+		fmt.Fprintf(w, "  %s %s in %s\n", c.RuleID, truncate(c.Secret), c.Template)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+func corpusTestScanner(t *testing.T) *Scanner {
+	t.Helper()
+	config := writeLayer(t, t.TempDir(), "corpus.toml", `
+[[rules]]
+id = "acme-token"
+regex = '''acme_live_[a-z0-9]{16}'''
+keywords = ["acme_live_"]
+
+[[rules]]
+id = "unreachable-token"
+regex = '''zz_never_[0-9]{4}'''
+keywords = ["keyword-not-in-the-regex"]
+`)
+	scanner, err := NewScanner([]string{config}, defaultTestPolicy(t), slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("NewScanner: %v", err)
+	}
+	t.Cleanup(scanner.Close)
+	return scanner
+}
+
+func TestGenerateCorpus(t *testing.T) {
+	scanner := corpusTestScanner(t)
+	examples := []ruleExample{{Rule: "acme-token", Match: []string{"ACME_TOKEN=acme_live_x7kq2vmn9pl4rt8w"}}}
+
+	cases, missing := generateCorpus(t.Context(), scanner, examples, 3, 7)
+	if len(cases) != 3 {
+		t.Fatalf("cases = %d, want 3", len(cases))
+	}
+	if cases[0].Source != "example" || cases[0].Secret != "acme_live_x7kq2vmn9pl4rt8w" {
+		t.Errorf("first case = %+v, want the example", cases[0])
+	}
+	for _, c := range cases[1:] {
+		if c.RuleID != "acme-token" || c.Source != "regex" {
+			t.Errorf("case = %+v, want a regex sample for acme-token", c)
+		}
+	}
+	// the rule's keyword never appears in its own samples
+	if !reflect.DeepEqual(missing, []string{"unreachable-token"}) {
+		t.Errorf("missing = %v", missing)
+	}
+
+	again, _ := generateCorpus(t.Context(), scanner, examples, 3, 7)
+	if !reflect.DeepEqual(cases, again) {
+		t.Error("the same seed generated a different corpus")
+	}
+}
+
+func TestTestCorpus(t *testing.T) {
+	scanner := corpusTestScanner(t)
+	cases, _ := generateCorpus(t.Context(), scanner, nil, 2, 1)
+
+	result := testCorpus(t.Context(), scanner, cases)
+	want := []ruleRecall{{RuleID: "acme-token", Cases: 2, Found: 2, Recall: 1}}
+	if !reflect.DeepEqual(result.Rules, want) || len(result.Missed) > 0 || len(result.Survived) > 0 {
+		t.Errorf("result = %+v, want every case caught", result)
+	}
+
+	// a config without the rule misses its cases and leaves the secrets in
+	result = testCorpus(t.Context(), newTestScanner(t, defaultTestPolicy(t)), cases)
+	if result.Rules[0].Found != 0 || len(result.Missed) != 2 || len(result.Survived) != 2 {
+		t.Errorf("result = %+v, want every case missed", result)
+	}
+}
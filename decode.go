@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/zricethezav/gitleaks/v8/report"
+)
+
+// decoder recognises an encoding that gitleaks' own decoder misses.
+// gitleaks only decodes base64 runs of 16+ characters and hex runs of 32+,
+// which skips most short Kubernetes secret values and spaced hex dumps.
+type decoder struct {
+	name string
+	// pattern locates candidate segments. If it has a capture group, only the
+	// first group is decoded and redacted.
+	pattern *regexp.Regexp
+	decode  func(string) (string, bool)
+}
+
+var decoders = []decoder{
+	{
+		// `password: cDRzcw==` under a Kubernetes Secret `data:` map
+		name:    "base64",
+		pattern: regexp.MustCompile(`(?m)^[ \t]+[\w.-]+:[ \t]*([A-Za-z0-9+/]{4,}={0,2})[ \t]*$`),
+		decode:  decodeShortBase64,
+	},
+	{
+		// `"password": "cDRzcw=="` from `kubectl get secret -o json`
+		name:    "base64",
+		pattern: regexp.MustCompile(`"[\w.-]+"[ \t]*:[ \t]*"([A-Za-z0-9+/]{4,}={0,2})"`),
+		decode:  decodeShortBase64,
+	},
+	{
+		// \x70\x34\x73\x73
+		name:    "hex",
+		pattern: regexp.MustCompile(`(?:\\x[0-9A-Fa-f]{2}){4,}`),
+		decode:  decodeHexBytes,
+	},
+	{
+		// 70 34 73 73 or 70:34:73:73
+		name:    "hex",
+		pattern: regexp.MustCompile(`\b(?:[0-9A-Fa-f]{2}[ :]){3,}[0-9A-Fa-f]{2}\b`),
+		decode:  decodeHexBytes,
+	},
+}
+
+// detectEncoded decodes the segments matched by our own decoders and scans the
+// decoded text. When the decoded text contains a secret, the whole encoded
+// segment is reported so it is redacted as a unit.
+func (s *Scanner) detectEncoded(ctx context.Context, text string, loc Location, depth int) []Finding {
+	var findings []Finding
+
+	for _, d := range decoders {
+		for _, m := range d.pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := m[0], m[1]
+			if len(m) >= 4 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			if end-start > s.policy.Decode.MaxSize {
+				s.log.Debug("skipping encoded segment: size", "decoder", d.name, "length", end-start)
+				continue
+			}
+
+			encoded := text[start:end]
+			decoded, ok := d.decode(encoded)
+			if !ok {
+				continue
+			}
+
+			for _, f := range s.inspect(ctx, decoded, loc, depth+1) {
+				findings = append(findings, Finding{
+					RuleID:     f.RuleID,
+					Secret:     encoded,
+					Encodings:  append([]string{d.name}, f.Encodings...),
+					Confidence: f.Confidence,
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// leakFinding converts a gitleaks finding into a Finding. Secrets that gitleaks
+// found after decoding do not appear verbatim in text, so the encoded span they
+// came from is used instead.
+func leakFinding(text string, leak report.Finding) Finding {
+	f := Finding{RuleID: leak.RuleID, Secret: leak.Secret}
+
+	for _, tag := range leak.Tags {
+		if encoding, ok := strings.CutPrefix(tag, "decoded:"); ok {
+			f.Encodings = append(f.Encodings, encoding)
+		}
+	}
+
+	if len(f.Encodings) > 0 {
+		if start, end, ok := leakSpan(text, leak); ok {
+			// rule regexes usually consume the delimiter after the secret
+			f.Secret = strings.TrimRight(text[start:end], " \t\r\n'\"`;,")
+		}
+	}
+
+	return f
+}
+
+// leakSpan maps the line/column location of a gitleaks finding back to byte
+// offsets in text. This mirrors the arithmetic in gitleaks' detect/location.go,
+// where columns on every line but the first are counted from the preceding newline.
+// gitleaks cannot place an end that overflows the last line, so in that case
+// the span runs to the end of the line instead.
+func leakSpan(text string, leak report.Finding) (int, int, bool) {
+	var newlines []int
+	for i := range len(text) {
+		if text[i] == '\n' {
+			newlines = append(newlines, i)
+		}
+	}
+
+	lineOffset := func(line int) (int, bool) {
+		if line == 0 {
+			return 0, true
+		}
+		if line < 0 || line > len(newlines) {
+			return 0, false
+		}
+		return newlines[line-1], true
+	}
+
+	startOffset, ok := lineOffset(leak.StartLine)
+	if !ok {
+		return 0, 0, false
+	}
+	start := startOffset + leak.StartColumn - 1
+	if start < 0 || start >= len(text) {
+		return 0, 0, false
+	}
+
+	end := -1
+	if endOffset, ok := lineOffset(leak.EndLine); ok {
+		end = endOffset + leak.EndColumn
+	}
+	if end <= start || end > len(text) {
+		end = len(text)
+		if i := strings.IndexByte(text[start:], '\n'); i >= 0 {
+			end = start + i
+		}
+	}
+
+	return start, end, true
+}
+
+func decodeShortBase64(encoded string) (string, bool) {
+	if len(encoded)%4 != 0 {
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	return string(decoded), isPrintable(decoded)
+}
+
+func decodeHexBytes(encoded string) (string, bool) {
+	digits := strings.NewReplacer(`\x`, "", " ", "", ":", "").Replace(encoded)
+	decoded, err := hex.DecodeString(digits)
+	if err != nil {
+		return "", false
+	}
+	return string(decoded), isPrintable(decoded)
+}
+
+// isPrintable reports whether b is non-empty UTF-8 text without control
+// characters other than common whitespace.
+func isPrintable(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
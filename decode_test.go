@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// hexEscape writes s as \x escapes, which gitleaks' own decoder skips.
+func hexEscape(s string) string {
+	var b strings.Builder
+	for i := range len(s) {
+		fmt.Fprintf(&b, `\x%02x`, s[i])
+	}
+	return b.String()
+}
+
+func TestDecoders(t *testing.T) {
+	tests := []struct {
+		name    string
+		decode  func(string) (string, bool)
+		encoded string
+		want    string
+		ok      bool
+	}{
+		{"base64", decodeShortBase64, "cDRzcw==", "p4ss", true},
+		{"base64 unpadded", decodeShortBase64, "cDRzcw", "", false},
+		{"base64 binary", decodeShortBase64, "AAECAw==", "", false},
+		{"hex escapes", decodeHexBytes, `\x70\x34\x73\x73`, "p4ss", true},
+		{"hex spaced", decodeHexBytes, "70 34 73 73", "p4ss", true},
+		{"hex colons", decodeHexBytes, "70:34:73:73", "p4ss", true},
+		{"hex odd", decodeHexBytes, "70 34 7", "", false},
+		{"hex control bytes", decodeHexBytes, `\x00\x01\x02\x03`, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := tt.decode(tt.encoded)
+		if ok != tt.ok || ok && got != tt.want {
+			t.Errorf("%s: decode(%q) = %q, %v, want %q, %v", tt.name, tt.encoded, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestScanEncoded(t *testing.T) {
+	scanner := newTestScanner(t, defaultTestPolicy(t))
+	b64 := base64.StdEncoding.EncodeToString([]byte(testToken))
+	escaped := hexEscape(testToken)
+	nested := base64.StdEncoding.EncodeToString([]byte(escaped))
+
+	tests := []struct {
+		name      string
+		text      string
+		secret    string
+		encodings []string
+	}{
+		{"kubernetes secret", "apiVersion: v1\nkind: Secret\ndata:\n  token: " + b64 + "\n", b64, []string{"base64"}},
+		{"hex escapes", `printf "` + escaped + `"`, escaped, []string{"hex"}},
+		{"hex in base64", "data:\n  token: " + nested + "\n", nested, []string{"base64", "hex"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := scanner.Scan(t.Context(), tt.text, Location{}).Findings
+			i := slices.IndexFunc(findings, func(f Finding) bool { return f.RuleID == "github-pat" })
+			if i < 0 {
+				t.Fatalf("findings = %+v, want github-pat", findings)
+			}
+			// the whole encoded span is redacted
+			if findings[i].Secret != tt.secret {
+				t.Errorf("secret = %q, want the encoded span %q", findings[i].Secret, tt.secret)
+			}
+			if !slices.Equal(findings[i].Encodings, tt.encodings) {
+				t.Errorf("encodings = %v, want %v", findings[i].Encodings, tt.encodings)
+			}
+		})
+	}
+}
+
+func TestScanEncodedLimits(t *testing.T) {
+	escaped := hexEscape(testToken)
+	nested := "data:\n  token: " + base64.StdEncoding.EncodeToString([]byte(escaped)) + "\n"
+	tests := []struct {
+		name   string
+		text   string
+		policy func(*Policy)
+	}{
+		{"depth", nested, func(p *Policy) { p.Decode.MaxDepth = 1 }},
+		{"off", escaped, func(p *Policy) { p.Decode.MaxDepth = 0 }},
+		{"size", escaped, func(p *Policy) { p.Decode.MaxSize = len(escaped) - 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := defaultTestPolicy(t)
+			tt.policy(&policy)
+			scanner := newTestScanner(t, policy)
+			// the encoded text itself may still look like a generic key
+			findings := scanner.Scan(t.Context(), tt.text, Location{}).Findings
+			if slices.ContainsFunc(findings, func(f Finding) bool { return f.RuleID == "github-pat" }) {
+				t.Errorf("findings = %+v, want no github-pat past the limit", findings)
+			}
+		})
+	}
+}
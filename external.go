@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// externalRestartDelay keeps a detector that crashes on startup from being
+// restarted on every request.
+const externalRestartDelay = time.Second
+
+// externalRequest and externalResponse are the lines exchanged with an
+// external detector over its stdin and stdout. Finding offsets are byte
+// offsets into the UTF-8 encoding of Text, not character offsets.
+type externalRequest struct {
+	ID       uint64   `json:"id"`
+	Text     string   `json:"text"`
+	Location Location `json:"location"`
+}
+
+type externalResponse struct {
+	ID       uint64       `json:"id"`
+	Findings []pluginSpan `json:"findings"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// externalDetector runs a long-lived executable as a detector. Requests are
+// sent one at a time as JSON lines on its stdin, and each must be answered
+// with a JSON line on its stdout carrying the same id. A detector that
+// crashes, or does not answer in time, is killed and restarted on the next
+// request. It should exit when its stdin is closed.
+type externalDetector struct {
+	name    string
+	command []string
+	timeout time.Duration
+	log     *slog.Logger
+
+	mu      sync.Mutex // serializes requests
+	proc    *externalProcess
+	nextID  uint64
+	retryAt time.Time
+	closed  bool
+}
+
+// externalProcess is one running instance of an external detector.
+type externalProcess struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	lines  chan []byte // closed when stdout is
+}
+
+// startExternalDetectors starts every detector in the policy, so a missing
+// executable is reported at startup. If one fails to start, those already
+// running are stopped.
+func startExternalDetectors(policies []ExternalPolicy, logger *slog.Logger) ([]Inspector, error) {
+	log := logger.With("component", "external")
+
+	for _, policy := range policies {
+		if policy.Name == "" || len(policy.Command) == 0 {
+			return nil, errors.New("external detectors need a name and a command")
+		}
+	}
+
+	var detectors []Inspector
+	for _, policy := range policies {
+		d := &externalDetector{
+			name:    "exec:" + policy.Name,
+			command: policy.Command,
+			timeout: policy.Timeout,
+			log:     log,
+		}
+		if d.timeout <= 0 {
+			d.timeout = time.Second
+		}
+		if err := d.start(); err != nil {
+			for _, started := range detectors {
+				started.(io.Closer).Close()
+			}
+			return nil, fmt.Errorf("start external detector %s: %w", policy.Name, err)
+		}
+		log.Info("started external detector", "inspector", d.name, "pid", d.proc.cmd.Process.Pid)
+		detectors = append(detectors, d)
+	}
+	return detectors, nil
+}
+
+func (d *externalDetector) Name() string { return d.name }
+
+// Inspect sends the text to the detector. A detector that fails or runs out
+// of time is logged and its findings for this text are skipped.
+func (d *externalDetector) Inspect(ctx context.Context, in Inspection) []Finding {
+	spans, err := d.call(ctx, in.Text, in.Location)
+	if err != nil {
+		d.log.Warn("external detector failed", "inspector", d.name, "error", err)
+		span := trace.SpanFromContext(ctx)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "external detector failed")
+		return in.Findings
+	}
+	return appendSpans(in.Findings, d.name, in.Text, spans, d.log)
+}
+
+func (d *externalDetector) call(ctx context.Context, text string, loc Location) ([]pluginSpan, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, errors.New("closed")
+	}
+	if d.proc == nil {
+		if time.Now().Before(d.retryAt) {
+			return nil, errors.New("not running, waiting to restart")
+		}
+		if err := d.start(); err != nil {
+			return nil, fmt.Errorf("restart: %w", err)
+		}
+		d.log.Info("restarted external detector", "inspector", d.name, "pid", d.proc.cmd.Process.Pid)
+	}
+
+	d.nextID++
+	line, err := json.Marshal(externalRequest{ID: d.nextID, Text: text, Location: loc})
+	if err != nil {
+		return nil, fmt.Errorf("encode request: %w", err)
+	}
+	if _, err := d.proc.stdin.Write(append(line, '\n')); err != nil {
+		d.stop()
+		return nil, fmt.Errorf("write request: %w", err)
+	}
+
+	timer := time.NewTimer(d.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case line, ok := <-d.proc.lines:
+			if !ok {
+				d.stop()
+				d.retryAt = time.Now().Add(externalRestartDelay)
+				return nil, errors.New("exited")
+			}
+			var resp externalResponse
+			if err := json.Unmarshal(line, &resp); err != nil {
+				d.stop()
+				return nil, fmt.Errorf("decode response: %w", err)
+			}
+			if resp.ID != d.nextID {
+				// a stale answer to an earlier request
+				continue
+			}
+			if resp.Error != "" {
+				return nil, errors.New(resp.Error)
+			}
+			return resp.Findings, nil
+		case <-timer.C:
+			// the answer may still come, so start over with a clean process
+			d.stop()
+			return nil, fmt.Errorf("no response within %s", d.timeout)
+		case <-ctx.Done():
+			d.stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close stops the detector for good.
+func (d *externalDetector) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	if d.proc != nil {
+		d.stop()
+	}
+	return nil
+}
+
+// start launches the detector. It must be called with d.mu held or before
+// the detector is shared.
+func (d *externalDetector) start() error {
+	cmd := exec.Command(d.command[0], d.command[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		d.retryAt = time.Now().Add(externalRestartDelay)
+		return err
+	}
+
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+		reader := bufio.NewReader(stdout)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				lines <- line
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	d.proc = &externalProcess{cmd: cmd, stdin: stdin, stdout: stdout, lines: lines}
+	return nil
+}
+
+// stop kills the detector and waits for it to exit. The next request
+// restarts it.
+func (d *externalDetector) stop() {
+	proc := d.proc
+	d.proc = nil
+
+	proc.stdin.Close()
+	proc.cmd.Process.Kill()
+	// a child the detector forked may still hold the write end of stdout, so
+	// close our end rather than wait for the pipe to reach EOF, then drain
+	// what was read so the reader goroutine can finish
+	proc.stdout.Close()
+	for range proc.lines {
+	}
+	if err := proc.cmd.Wait(); err != nil {
+		d.log.Warn("external detector stopped", "inspector", d.name, "error", err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// The test binary doubles as an external detector when this is set. It
+// reports every "SECRET-" word, by byte offset, or by character offset when
+// the value is "chars". With "fork" it starts a child that inherits its
+// stdout, writes the child's pid to the file named by detectorPidFileEnv and
+// never answers.
+const (
+	detectorHelperEnv  = "CLAUDE_GITLEAKS_TEST_DETECTOR"
+	detectorPidFileEnv = "CLAUDE_GITLEAKS_TEST_DETECTOR_PIDFILE"
+)
+
+func TestExternalDetectorHelper(t *testing.T) {
+	mode := os.Getenv(detectorHelperEnv)
+	if mode == "" {
+		t.Skip("only runs as an external detector")
+	}
+	if mode == "fork" {
+		child := exec.Command("sleep", "60")
+		child.Stdout = os.Stdout
+		if err := child.Start(); err != nil {
+			os.Exit(1)
+		}
+		os.WriteFile(os.Getenv(detectorPidFileEnv), []byte(strconv.Itoa(child.Process.Pid)), 0o600)
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	}
+
+	lines := bufio.NewScanner(os.Stdin)
+	lines.Buffer(nil, 1<<20)
+	out := json.NewEncoder(os.Stdout)
+	for lines.Scan() {
+		var req externalRequest
+		if err := json.Unmarshal(lines.Bytes(), &req); err != nil {
+			out.Encode(externalResponse{Error: err.Error()})
+			continue
+		}
+		resp := externalResponse{ID: req.ID, Findings: []pluginSpan{}}
+		for offset := 0; ; {
+			i := strings.Index(req.Text[offset:], "SECRET-")
+			if i < 0 {
+				break
+			}
+			start := offset + i
+			end := start + strings.IndexAny(req.Text[start:]+" ", " \n")
+			span := pluginSpan{Start: start, End: end, Rule: "helper-" + req.Location.Block}
+			if mode == "chars" {
+				span.Start = utf8.RuneCountInString(req.Text[:start])
+				span.End = utf8.RuneCountInString(req.Text[:end])
+			}
+			resp.Findings = append(resp.Findings, span)
+			offset = end
+		}
+		out.Encode(resp)
+	}
+	os.Exit(0)
+}
+
+func helperDetector(t *testing.T, name, mode string) ExternalPolicy {
+	t.Helper()
+	t.Setenv(detectorHelperEnv, mode)
+	return ExternalPolicy{Name: name, Command: []string{os.Args[0], "-test.run=^TestExternalDetectorHelper$"}, Timeout: 5 * time.Second}
+}
+
+func TestExternalDetector(t *testing.T) {
+	tests := []struct {
+		mode string
+		want []string
+	}{
+		{"bytes", []string{"SECRET-one", "SECRET-two"}},
+		// a character offset that falls inside "é" is dropped
+		{"chars", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			detectors, err := startExternalDetectors([]ExternalPolicy{helperDetector(t, "helper", tt.mode)}, slog.New(slog.DiscardHandler))
+			if err != nil {
+				t.Fatalf("startExternalDetectors: %v", err)
+			}
+			detector := detectors[0]
+			defer detector.(io.Closer).Close()
+			if detector.Name() != "exec:helper" {
+				t.Errorf("name = %s", detector.Name())
+			}
+
+			text := "xéé SECRET-one\nxéé SECRET-two"
+			findings := detector.Inspect(context.Background(), Inspection{Text: text, Location: Location{Block: "text"}})
+			var got []string
+			for _, f := range findings {
+				if f.RuleID != "helper-text" {
+					t.Errorf("rule = %s, want helper-text", f.RuleID)
+				}
+				got = append(got, f.Secret)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("secrets = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExternalDetectorStopWithForkedChild(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("needs sleep")
+	}
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	t.Setenv(detectorPidFileEnv, pidFile)
+	policy := helperDetector(t, "fork", "fork")
+	policy.Timeout = 500 * time.Millisecond
+
+	detectors, err := startExternalDetectors([]ExternalPolicy{policy}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("startExternalDetectors: %v", err)
+	}
+	detector := detectors[0]
+	defer detector.(io.Closer).Close()
+	t.Cleanup(func() {
+		data, err := os.ReadFile(pidFile)
+		if err != nil {
+			return
+		}
+		if pid, err := strconv.Atoi(string(data)); err == nil {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+	})
+
+	// the detector never answers, so it is killed; its child keeps stdout open
+	done := make(chan []Finding)
+	go func() {
+		done <- detector.Inspect(context.Background(), Inspection{Text: "SECRET-one"})
+	}()
+	select {
+	case findings := <-done:
+		if len(findings) > 0 {
+			t.Errorf("findings = %v, want none", findings)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Inspect did not return after the detector timed out")
+	}
+}
+
+func TestStartExternalDetectorsStopsStartedOnFailure(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("needs /proc to list child processes")
+	}
+	policies := []ExternalPolicy{
+		helperDetector(t, "first", "bytes"),
+		{Name: "missing", Command: []string{filepath.Join(t.TempDir(), "no-such-detector")}},
+	}
+	if _, err := startExternalDetectors(policies, slog.New(slog.DiscardHandler)); err == nil {
+		t.Fatal("startExternalDetectors succeeded with a missing executable")
+	}
+	if children := childProcesses(t); len(children) > 0 {
+		t.Errorf("detectors still running: %v", children)
+	}
+}
+
+// childProcesses lists the pids whose parent is this process.
+func childProcesses(t *testing.T) []int {
+	t.Helper()
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var children []int
+	for _, path := range stats {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue // exited since the glob
+		}
+		// pid (comm) state ppid ...; comm may contain spaces
+		fields := strings.Fields(string(data[bytes.LastIndexByte(data, ')')+1:]))
+		if len(fields) > 1 && fields[1] == strconv.Itoa(os.Getpid()) {
+			pid, _ := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+			children = append(children, pid)
+		}
+	}
+	return children
+}
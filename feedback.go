@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// feedbackRequest marks a finding as a false positive.
+type feedbackRequest struct {
+	// Fingerprint is the finding's fingerprint, as logged and shown by /scan
+	// and the scan command.
+	Fingerprint string `json:"fingerprint"`
+	// Reason says why it is a false positive. It is required.
+	Reason string `json:"reason"`
+	// User is who reported it. It defaults to the remote address.
+	User string `json:"user,omitempty"`
+	// Regex, if set, is added to the rule's allowlists in the overlay
+	// config, matched against the secret, instead of ignoring the one
+	// fingerprint.
+	Regex string `json:"regex,omitempty"`
+}
+
+// feedbackResponse reports what was written where.
+type feedbackResponse struct {
+	File  string `json:"file"`
+	Entry string `json:"entry"`
+}
+
+// handleFeedback records a false positive and applies it right away.
+func (p *Proxy) handleFeedback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	scanner := p.scanner.Load()
+	policy := scanner.policy.Feedback
+	if policy.IgnoreFile == "" {
+		http.Error(w, "Feedback is not enabled", http.StatusNotFound)
+		return
+	}
+	// loadPolicy requires a token when feedback is on
+	if !authorized(r, policy.Token) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req feedbackRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "Invalid feedback: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.User == "" {
+		req.User = r.RemoteAddr
+	}
+
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+	// a reload may have swapped the scanner while the body was read; the
+	// feedback files are the same unless the policy changed them
+	if current := p.scanner.Load(); current.policy.Feedback == policy {
+		scanner = current
+	}
+	resp, err := recordFeedback(policy, scanner, req, time.Now())
+	if err != nil {
+		http.Error(w, "Invalid feedback: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	slog.Info("false positive recorded", "fingerprint", req.Fingerprint, "user", req.User, "reason", req.Reason, "file", resp.File)
+
+	// apply it to the current scanner; a policy reload rereads both files
+	if err := errors.Join(scanner.ignore.Load(), scanner.ReloadConfig()); err != nil {
+		slog.Error("failed to apply feedback", "error", err)
+		http.Error(w, "Feedback recorded but not applied: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// authorized reports whether r carries token as its bearer token. An empty
+// token authorizes nothing.
+func authorized(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// recordFeedback appends a false positive to the managed ignore file, or,
+// with a regex, to the rule's allowlists in the overlay config. Each entry is
+// preceded by a comment recording who reported it, when and why.
+func recordFeedback(policy FeedbackPolicy, scanner *Scanner, req feedbackRequest, now time.Time) (feedbackResponse, error) {
+	req.Fingerprint = strings.TrimSpace(req.Fingerprint)
+	if req.Fingerprint == "" || strings.ContainsAny(req.Fingerprint, "\r\n#") {
+		return feedbackResponse{}, errors.New("a fingerprint is required")
+	}
+	rule, _, ok := parseIgnoreEntry(req.Fingerprint)
+	if !ok {
+		return feedbackResponse{}, fmt.Errorf("malformed fingerprint %q", req.Fingerprint)
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		return feedbackResponse{}, errors.New("a reason is required")
+	}
+	comment := fmt.Sprintf("# %s by %s: %s\n", now.UTC().Format(time.RFC3339), oneLine(req.User), oneLine(req.Reason))
+
+	if req.Regex == "" {
+		entry := req.Fingerprint + "\n"
+		if err := appendFile(policy.IgnoreFile, comment+entry); err != nil {
+			return feedbackResponse{}, err
+		}
+		return feedbackResponse{File: policy.IgnoreFile, Entry: strings.TrimSpace(entry)}, nil
+	}
+
+	if policy.Config == "" {
+		return feedbackResponse{}, errors.New("allowlist regexes need feedback.config in the policy")
+	}
+	if _, ok := scanner.gitleaks.Load().rules.Config.Rules[rule]; !ok {
+		return feedbackResponse{}, fmt.Errorf("%s is not a gitleaks rule, only gitleaks rules have allowlists", rule)
+	}
+	if _, err := regexp.Compile(req.Regex); err != nil {
+		return feedbackResponse{}, fmt.Errorf("invalid regex: %w", err)
+	}
+	entry := fmt.Sprintf("[[rules]]\nid = %s\n[[rules.allowlists]]\ndescription = %s\nregexTarget = \"secret\"\nregexes = [%s]\n",
+		tomlString(rule), tomlString("false positive "+req.Fingerprint), tomlString(req.Regex))
+	if err := appendFile(policy.Config, "\n"+comment+entry); err != nil {
+		return feedbackResponse{}, err
+	}
+	return feedbackResponse{File: policy.Config, Entry: entry}, nil
+}
+
+func appendFile(path, text string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	if _, err := file.WriteString(text); err != nil {
+		file.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+// oneLine keeps free text from breaking out of a comment line.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// tomlString quotes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case unicode.IsControl(r):
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// runFeedback implements `claude-gitleaks feedback`, which marks a finding as
+// a false positive on a running proxy.
+func runFeedback(args []string) error {
+	flags := flag.NewFlagSet("feedback", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: claude-gitleaks feedback -reason text [flags] fingerprint")
+		flags.PrintDefaults()
+	}
+	addr := flags.String("addr", "http://localhost:8000", "address of the running proxy")
+	token := flags.String("token", os.Getenv("CLAUDE_GITLEAKS_TOKEN"), "feedback token (default $CLAUDE_GITLEAKS_TOKEN)")
+	reason := flags.String("reason", "", "why the finding is a false positive (required)")
+	user := flags.String("user", os.Getenv("USER"), "who is reporting it")
+	regex := flags.String("regex", "", "allowlist regex for the finding's rule, matched against the secret, instead of ignoring the one fingerprint")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 || *reason == "" {
+		flags.Usage()
+		return errors.New("feedback needs a fingerprint and a -reason")
+	}
+
+	body, err := json.Marshal(feedbackRequest{Fingerprint: flags.Arg(0), Reason: *reason, User: *user, Regex: *regex})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(*addr, "/")+"/admin/feedback", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send feedback: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("send feedback: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var result feedbackResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	fmt.Printf("added to %s:\n%s\n", result.File, strings.TrimSpace(result.Entry))
+	return nil
+}
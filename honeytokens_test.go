@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHoneytoken = "AKIAHONEYPOTDECOY7Q2Z"
+
+func writeHoneytokens(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "honeytokens.env")
+	if err := os.WriteFile(path, []byte("DECOY_AWS_KEY="+testHoneytoken+"\nDECOY_DB=p@ss w0rd/decoy\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHoneytokensDetectEncoded(t *testing.T) {
+	registry, err := newKnownSecrets(honeytokenRuleID, KnownSecretsPolicy{Files: []string{writeHoneytokens(t)}, MinLength: 6}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("newKnownSecrets: %v", err)
+	}
+
+	basic := base64.StdEncoding.EncodeToString([]byte("svc:" + testHoneytoken))
+	tests := []struct {
+		name   string
+		text   string
+		rule   string
+		secret string // what is redacted; empty means the value itself
+	}{
+		{"plain", "key " + testHoneytoken, "honeytoken:DECOY_AWS_KEY", ""},
+		{"basic auth", "Authorization: Basic " + basic, "honeytoken:DECOY_AWS_KEY", basic},
+		{"base64 at every offset", "blob " + base64.StdEncoding.EncodeToString([]byte("xx"+testHoneytoken+"yy")) + " end", "honeytoken:DECOY_AWS_KEY", base64.StdEncoding.EncodeToString([]byte("xx" + testHoneytoken + "yy"))},
+		{"url alphabet", "t=" + base64.RawURLEncoding.EncodeToString([]byte("?>"+testHoneytoken)), "honeytoken:DECOY_AWS_KEY", base64.RawURLEncoding.EncodeToString([]byte("?>" + testHoneytoken))},
+		{"query", "https://db.example/?password=" + url.QueryEscape("p@ss w0rd/decoy"), "honeytoken:DECOY_DB", url.QueryEscape("p@ss w0rd/decoy")},
+		{"path", "https://db.example/" + url.PathEscape("p@ss w0rd/decoy"), "honeytoken:DECOY_DB", url.PathEscape("p@ss w0rd/decoy")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.secret
+			if want == "" {
+				want = testHoneytoken
+			}
+			findings := registry.Detect(tt.text)
+			found := false
+			for _, f := range findings {
+				if f.RuleID == tt.rule && f.Secret == want {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Detect(%q) = %v, want %s with secret %q", tt.text, findings, tt.rule, want)
+			}
+		})
+	}
+
+	if findings := registry.Detect("unrelated " + base64.StdEncoding.EncodeToString([]byte("nothing to see here"))); len(findings) > 0 {
+		t.Errorf("Detect on unrelated base64 = %v, want none", findings)
+	}
+}
+
+func TestScannerTripsDecodedHoneytoken(t *testing.T) {
+	policy := defaultTestPolicy(t)
+	policy.Honeytokens.Files = []string{writeHoneytokens(t)}
+	scanner := newTestScanner(t, policy)
+
+	// only the decode inspector's hex layer reveals it
+	var escaped strings.Builder
+	for _, b := range []byte(testHoneytoken) {
+		escaped.WriteString(`\x` + hex.EncodeToString([]byte{b}))
+	}
+	text := `printf '` + escaped.String() + `'`
+	result := scanner.Scan(context.Background(), text, Location{Block: "text"})
+	tripped := result.Honeytokens()
+	if len(tripped) == 0 {
+		t.Fatalf("no honeytoken in %v", result.Findings)
+	}
+	if got := redactSecrets(text, result.Findings); strings.Contains(got, escaped.String()) {
+		t.Errorf("encoded honeytoken left in %s", got)
+	}
+}
+
+func TestAuditLogClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := newAuditLog(path)
+	if err != nil {
+		t.Fatalf("newAuditLog: %v", err)
+	}
+	if err := audit.Record(auditEntry{Event: "honeytoken.tripped"}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	if err := audit.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	// after shutdown, late entries are dropped rather than failing
+	if err := audit.Record(auditEntry{Event: "late"}); err != nil {
+		t.Errorf("Record after Close: %v", err)
+	}
+	if err := audit.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(data), "\n"); got != 1 {
+		t.Errorf("audit log has %d entries, want 1", got)
+	}
+}
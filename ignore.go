@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// allowMarker on a line exempts the secrets on it, as it does for gitleaks.
+const allowMarker = "gitleaks:allow"
+
+var (
+	// fingerprintHash is the secret hash at the end of a proxy fingerprint.
+	fingerprintHash = regexp.MustCompile(`^[0-9a-f]{16}$`)
+	// commitHash prefixes the fingerprints gitleaks writes for git history.
+	commitHash = regexp.MustCompile(`^[0-9a-f]{40}:`)
+	// readLineNumber is the line number Claude Code's Read tool puts in
+	// front of every line of a file.
+	readLineNumber = regexp.MustCompile(`^\s*(\d+)(?:→|\t)`)
+)
+
+// fingerprint identifies a finding across requests without containing the
+// secret: "<path>:<rule>:<hash>", where path is the file the secret was read
+// from and hash comes from secretHash. Findings with no known source file are
+// fingerprinted as "<rule>:<hash>".
+func fingerprint(f Finding, key []byte) string {
+	hash := secretHash(f.Secret, key)
+	if f.Location.Path == "" {
+		return f.RuleID + ":" + hash
+	}
+	return f.Location.Path + ":" + f.RuleID + ":" + hash
+}
+
+// secretHash is the first 16 hex digits of the secret's SHA-256, or of its
+// HMAC-SHA256 under key if there is one. Fingerprints end up in logs, reject
+// messages and feedback files; without a key, anyone who reads one can test
+// guesses of a short or low-entropy secret against it offline.
+func secretHash(secret string, key []byte) string {
+	if key == nil {
+		sum := sha256.Sum256([]byte(secret))
+		return hex.EncodeToString(sum[:8])
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(secret))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// ignoreEntry is one line of an ignore file. Proxy fingerprints carry a
+// secret hash; gitleaks fingerprints ("[commit:]file:rule:line") carry a line
+// number instead, which is only known for Read tool results.
+type ignoreEntry struct {
+	path string // empty matches any source
+	hash string
+	line int
+}
+
+// ignoreList holds the fingerprints of findings to pass through, read from
+// .gitleaksignore files. Honeytokens and registered secrets are never ignored.
+type ignoreList struct {
+	policy IgnorePolicy
+	log    *slog.Logger
+	// key keys the secret hashes of fingerprints. Load does not reread it,
+	// since changing it changes every fingerprint.
+	key []byte
+
+	mu      sync.RWMutex
+	entries map[string][]ignoreEntry // by rule ID
+}
+
+func newIgnoreList(policy IgnorePolicy, logger *slog.Logger) (*ignoreList, error) {
+	l := &ignoreList{policy: policy, log: logger.With("component", "ignore")}
+	if policy.FingerprintKeyFile != "" {
+		key, err := loadKeyFile(policy.FingerprintKeyFile, "fingerprint key")
+		if err != nil {
+			return nil, err
+		}
+		l.key = key
+	}
+	if err := l.Load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Load (re)reads the ignore files. Missing files are skipped, so the default
+// .gitleaksignore is optional. On error the previous list stays active.
+func (l *ignoreList) Load() error {
+	entries := make(map[string][]ignoreEntry)
+	count := 0
+	for _, file := range l.policy.Files {
+		data, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			l.log.Debug("ignore file not found", "path", file)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("read ignore file %s: %w", file, err)
+		}
+
+		scanner := bufio.NewScanner(strings.NewReader(string(data)))
+		for n := 1; scanner.Scan(); n++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			rule, entry, ok := parseIgnoreEntry(text)
+			if !ok {
+				l.log.Warn("skipping malformed fingerprint", "path", file, "line", n)
+				continue
+			}
+			entries[rule] = append(entries[rule], entry)
+			count++
+		}
+	}
+
+	l.mu.Lock()
+	l.entries = entries
+	l.mu.Unlock()
+
+	l.log.Info("loaded ignore list", "count", count)
+	return nil
+}
+
+// parseIgnoreEntry parses a proxy fingerprint ("[path:]rule:hash") or a
+// gitleaks one ("[commit:]file:rule:line"). Fields are split from the right,
+// as paths may contain colons.
+func parseIgnoreEntry(text string) (string, ignoreEntry, bool) {
+	rest, last, ok := cutLast(text, ":")
+	if !ok {
+		return "", ignoreEntry{}, false
+	}
+	var entry ignoreEntry
+	if fingerprintHash.MatchString(last) {
+		entry.hash = last
+	} else if line, err := strconv.Atoi(last); err == nil && line > 0 {
+		entry.line = line
+	} else {
+		return "", ignoreEntry{}, false
+	}
+
+	rule := rest
+	if p, r, ok := cutLast(rest, ":"); ok {
+		entry.path, rule = cleanIgnorePath(commitHash.ReplaceAllString(p, "")), r
+	}
+	if rule == "" || entry.line > 0 && entry.path == "" {
+		return "", ignoreEntry{}, false
+	}
+	return rule, entry, true
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return "", s, false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+func cleanIgnorePath(p string) string {
+	return path.Clean(strings.ReplaceAll(p, `\`, "/"))
+}
+
+// Fingerprint returns the fingerprint of f, keyed with the policy's
+// fingerprint key.
+func (l *ignoreList) Fingerprint(f Finding) string {
+	return fingerprint(f, l.key)
+}
+
+// Ignored reports whether f, found in text, matches an ignore entry.
+func (l *ignoreList) Ignored(f Finding, text string) bool {
+	l.mu.RLock()
+	entries := l.entries[f.RuleID]
+	l.mu.RUnlock()
+	if len(entries) == 0 {
+		return false
+	}
+
+	hash := secretHash(f.Secret, l.key)
+	line := 0
+	for _, entry := range entries {
+		if entry.path != "" && !pathHasSuffix(f.Location.Path, entry.path) {
+			continue
+		}
+		if entry.hash != "" {
+			if entry.hash == hash {
+				return true
+			}
+			continue
+		}
+		if line == 0 && f.Location.ToolName == "Read" {
+			line = readLine(text, f.Secret)
+		}
+		if line > 0 && entry.line == line {
+			return true
+		}
+	}
+	return false
+}
+
+// pathHasSuffix reports whether the absolute path a tool read matches the
+// path from an ignore file, which is usually relative to a repository root.
+func pathHasSuffix(source, suffix string) bool {
+	if source == "" {
+		return false
+	}
+	source = cleanIgnorePath(source)
+	return source == suffix || strings.HasSuffix(source, "/"+strings.TrimPrefix(suffix, "./"))
+}
+
+// readLine returns the file line number Read output gives the line where
+// secret first appears, or 0 if there is none.
+func readLine(text, secret string) int {
+	i := strings.Index(text, secret)
+	if i < 0 {
+		return 0
+	}
+	start := strings.LastIndex(text[:i], "\n") + 1
+	m := readLineNumber.FindStringSubmatch(text[start:])
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// allowedByMarker reports whether every line secret appears on carries a
+// gitleaks:allow marker. Redaction replaces every occurrence, so a single
+// unmarked one keeps the secret redacted.
+func allowedByMarker(text, secret string) bool {
+	found := false
+	for i := 0; ; {
+		j := strings.Index(text[i:], secret)
+		if j < 0 {
+			return found
+		}
+		start := i + j
+		end := start + len(secret)
+		lineStart := strings.LastIndex(text[:start], "\n") + 1
+		lineEnd := strings.Index(text[end:], "\n")
+		if lineEnd < 0 {
+			lineEnd = len(text)
+		} else {
+			lineEnd += end
+		}
+		if !strings.Contains(text[lineStart:lineEnd], allowMarker) {
+			return false
+		}
+		found = true
+		i = end
+	}
+}
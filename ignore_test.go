@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	f := Finding{RuleID: "github-pat", Secret: testToken}
+	sum := sha256.Sum256([]byte(testToken))
+	unkeyed := "github-pat:" + hex.EncodeToString(sum[:8])
+	if got := fingerprint(f, nil); got != unkeyed {
+		t.Errorf("fingerprint = %s, want %s", got, unkeyed)
+	}
+
+	f.Location.Path = "/repo/.env"
+	if got := fingerprint(f, nil); got != "/repo/.env:"+unkeyed {
+		t.Errorf("fingerprint with path = %s", got)
+	}
+
+	keyA := []byte(strings.Repeat("a", 32))
+	keyB := []byte(strings.Repeat("b", 32))
+	a, b := secretHash(testToken, keyA), secretHash(testToken, keyB)
+	if a == secretHash(testToken, nil) || a == b {
+		t.Errorf("keyed hashes = %s, %s, want them to differ from each other and the unkeyed one", a, b)
+	}
+	if !fingerprintHash.MatchString(a) {
+		t.Errorf("keyed hash %s is not 16 hex digits", a)
+	}
+	if a != secretHash(testToken, keyA) {
+		t.Error("keyed hash is not deterministic")
+	}
+}
+
+func TestParseIgnoreEntry(t *testing.T) {
+	tests := []struct {
+		text  string
+		rule  string
+		entry ignoreEntry
+		ok    bool
+	}{
+		{"github-pat:0123456789abcdef", "github-pat", ignoreEntry{hash: "0123456789abcdef"}, true},
+		{"/repo/.env:github-pat:0123456789abcdef", "github-pat", ignoreEntry{path: "/repo/.env", hash: "0123456789abcdef"}, true},
+		{`C:\repo\.env:github-pat:0123456789abcdef`, "github-pat", ignoreEntry{path: "C:/repo/.env", hash: "0123456789abcdef"}, true},
+		{"config/.env:generic-api-key:12", "generic-api-key", ignoreEntry{path: "config/.env", line: 12}, true},
+		{"0123456789abcdef0123456789abcdef01234567:config/.env:generic-api-key:12", "generic-api-key", ignoreEntry{path: "config/.env", line: 12}, true},
+		// a line number needs a file
+		{"generic-api-key:12", "", ignoreEntry{}, false},
+		{"github-pat:not-a-hash", "", ignoreEntry{}, false},
+		{"github-pat:0", "", ignoreEntry{}, false},
+		{"0123456789abcdef", "", ignoreEntry{}, false},
+	}
+	for _, tt := range tests {
+		rule, entry, ok := parseIgnoreEntry(tt.text)
+		if ok != tt.ok || rule != tt.rule || entry != tt.entry {
+			t.Errorf("parseIgnoreEntry(%q) = %q, %+v, %v, want %q, %+v, %v", tt.text, rule, entry, ok, tt.rule, tt.entry, tt.ok)
+		}
+	}
+}
+
+func TestIgnoreListKeyedFingerprints(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "fingerprint.key")
+	if err := os.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ignoreFile := filepath.Join(dir, ".gitleaksignore")
+	logger := slog.New(slog.DiscardHandler)
+
+	keyed, err := newIgnoreList(IgnorePolicy{Files: []string{ignoreFile}, FingerprintKeyFile: keyFile}, logger)
+	if err != nil {
+		t.Fatalf("newIgnoreList: %v", err)
+	}
+	f := Finding{RuleID: "github-pat", Secret: testToken, Location: Location{Path: "/repo/.env"}}
+	entry := keyed.Fingerprint(f)
+	if entry == fingerprint(f, nil) {
+		t.Fatal("fingerprint is not keyed")
+	}
+	if err := os.WriteFile(ignoreFile, []byte(entry+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyed.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if !keyed.Ignored(f, "") {
+		t.Error("keyed fingerprint was not ignored")
+	}
+
+	// the same entry means nothing without the key
+	unkeyed, err := newIgnoreList(IgnorePolicy{Files: []string{ignoreFile}}, logger)
+	if err != nil {
+		t.Fatalf("newIgnoreList: %v", err)
+	}
+	if unkeyed.Ignored(f, "") {
+		t.Error("keyed fingerprint matched without the key")
+	}
+
+	if err := os.WriteFile(keyFile, []byte("short"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newIgnoreList(IgnorePolicy{FingerprintKeyFile: keyFile}, logger); err == nil {
+		t.Error("newIgnoreList accepted a malformed key")
+	}
+}
+
+func TestIgnoredByReadLine(t *testing.T) {
+	dir := t.TempDir()
+	ignoreFile := filepath.Join(dir, ".gitleaksignore")
+	if err := os.WriteFile(ignoreFile, []byte("config/.env:github-pat:2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	l, err := newIgnoreList(IgnorePolicy{Files: []string{ignoreFile}}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("newIgnoreList: %v", err)
+	}
+	text := "     1\tNAME=app\n     2\tTOKEN=" + testToken + "\n"
+	read := Location{Block: "tool_result", ToolName: "Read", Path: "/home/me/repo/config/.env"}
+	if !l.Ignored(Finding{RuleID: "github-pat", Secret: testToken, Location: read}, text) {
+		t.Error("gitleaks fingerprint did not match the Read line")
+	}
+	other := read
+	other.Path = "/home/me/repo/other/.env"
+	if l.Ignored(Finding{RuleID: "github-pat", Secret: testToken, Location: other}, text) {
+		t.Error("gitleaks fingerprint matched another file")
+	}
+}
+
+func TestAllowedByMarker(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"key = s3cr3t # gitleaks:allow", true},
+		{"a = s3cr3t # gitleaks:allow\nb = s3cr3t // gitleaks:allow", true},
+		// redaction replaces every occurrence, so one unmarked line keeps it
+		{"a = s3cr3t # gitleaks:allow\nb = s3cr3t", false},
+		{"# gitleaks:allow\nkey = s3cr3t", false},
+		{"nothing here", false},
+	}
+	for _, tt := range tests {
+		if got := allowedByMarker(tt.text, "s3cr3t"); got != tt.want {
+			t.Errorf("allowedByMarker(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
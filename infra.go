@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Infrastructure findings are reported as infra-hostname, infra-ip, or
+// infra-<name> for a literal identifier list.
+const (
+	infraRulePrefix = "infra-"
+	infraHostRuleID = infraRulePrefix + "hostname"
+	infraIPRuleID   = infraRulePrefix + "ip"
+	pseudonymDomain = ".internal.example"
+)
+
+var (
+	ipv4Candidate = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	// loose on purpose, candidates are checked with netip.ParseAddr
+	ipv6Candidate = regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}`)
+)
+
+// infraDetector finds internal hostnames, addresses in private ranges and
+// literal identifiers such as AWS account IDs or project codes.
+type infraDetector struct {
+	hosts       *regexp.Regexp // nil if no domain suffixes are configured
+	prefixes    []netip.Prefix
+	literals    *regexp.Regexp // nil if no identifiers are configured
+	literalKind map[string]string
+}
+
+// newInfraDetector compiles the identifiers listed in policy.
+// It returns nil if the policy lists nothing.
+func newInfraDetector(policy InfraPolicy) (*infraDetector, error) {
+	d := &infraDetector{literalKind: make(map[string]string)}
+
+	if len(policy.DomainSuffixes) > 0 {
+		suffixes := make([]string, len(policy.DomainSuffixes))
+		for i, suffix := range policy.DomainSuffixes {
+			suffixes[i] = regexp.QuoteMeta(strings.Trim(suffix, "."))
+		}
+		d.hosts = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)*(?:` + strings.Join(suffixes, "|") + `)\b`)
+	}
+
+	for _, cidr := range policy.CIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parse infra.cidrs entry %q: %w", cidr, err)
+		}
+		d.prefixes = append(d.prefixes, prefix.Masked())
+	}
+
+	var literals []string
+	for kind, values := range policy.Identifiers {
+		for _, value := range values {
+			if value == "" {
+				continue
+			}
+			d.literalKind[value] = kind
+			literals = append(literals, regexp.QuoteMeta(value))
+		}
+	}
+	if len(literals) > 0 {
+		// longest first, so an identifier that contains another one wins
+		slices.SortFunc(literals, func(a, b string) int { return len(b) - len(a) })
+		d.literals = regexp.MustCompile(strings.Join(literals, "|"))
+	}
+
+	if d.hosts == nil && len(d.prefixes) == 0 && d.literals == nil {
+		return nil, nil
+	}
+	return d, nil
+}
+
+// Detect returns a finding for every internal identifier in text.
+// A nil detector finds nothing. Pseudonymizing is not a leak, so the
+// findings are redacted even when the proxy runs with -reject.
+func (d *infraDetector) Detect(text string) []Finding {
+	if d == nil {
+		return nil
+	}
+
+	var findings []Finding
+
+	if d.hosts != nil {
+		for _, m := range d.hosts.FindAllStringIndex(text, -1) {
+			// db.corp.internal.attacker.com is not an internal host
+			if rest := text[m[1]:]; len(rest) > 1 && rest[0] == '.' && isHostChar(rest[1]) {
+				continue
+			}
+			findings = append(findings, Finding{RuleID: infraHostRuleID, Secret: text[m[0]:m[1]], Action: actionRedact, Confidence: 1})
+		}
+	}
+
+	if len(d.prefixes) > 0 {
+		for _, re := range []*regexp.Regexp{ipv4Candidate, ipv6Candidate} {
+			for _, candidate := range re.FindAllString(text, -1) {
+				addr, err := netip.ParseAddr(candidate)
+				if err != nil || !slices.ContainsFunc(d.prefixes, func(p netip.Prefix) bool { return p.Contains(addr) }) {
+					continue
+				}
+				findings = append(findings, Finding{RuleID: infraIPRuleID, Secret: candidate, Action: actionRedact, Confidence: 1})
+			}
+		}
+	}
+
+	if d.literals != nil {
+		for _, m := range d.literals.FindAllStringIndex(text, -1) {
+			// 123456789012 inside a longer number is not the account ID
+			if m[0] > 0 && isHostChar(text[m[0]-1]) || m[1] < len(text) && isHostChar(text[m[1]]) {
+				continue
+			}
+			value := text[m[0]:m[1]]
+			findings = append(findings, Finding{RuleID: infraRulePrefix + d.literalKind[value], Secret: value, Action: actionRedact, Confidence: 1})
+		}
+	}
+
+	return findings
+}
+
+func isHostChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+}
+
+// Apply sets the pseudonym as the replacement of every infrastructure
+// finding, assigning new pseudonyms as needed.
+func (s *session) Apply(findings []Finding) []Finding {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range findings {
+		kind, ok := strings.CutPrefix(f.RuleID, infraRulePrefix)
+		if !ok {
+			continue
+		}
+		pseudonym, ok := s.forward[f.Secret]
+		if !ok {
+			s.counts[kind]++
+			switch kind {
+			case "hostname":
+				pseudonym = fmt.Sprintf("host-%d%s", s.counts[kind], pseudonymDomain)
+			case "ip":
+				pseudonym = fmt.Sprintf("ip-%d%s", s.counts[kind], pseudonymDomain)
+			default:
+				pseudonym = fmt.Sprintf("%s-%d", kind, s.counts[kind])
+			}
+			s.forward[f.Secret] = pseudonym
+			s.reverse[pseudonym] = f.Secret
+			s.replacer = nil
+		}
+		findings[i].Replacement = pseudonym
+	}
+	return findings
+}
+
+// Reverse replaces every pseudonym in text with the real identifier.
+func (s *session) Reverse(text string) string {
+	s.mu.Lock()
+	if s.replacer == nil {
+		pseudonyms := make([]string, 0, len(s.reverse))
+		for pseudonym := range s.reverse {
+			pseudonyms = append(pseudonyms, pseudonym)
+		}
+		// longest first, so project-12 is not read as project-1 followed by 2
+		slices.SortFunc(pseudonyms, func(a, b string) int { return len(b) - len(a) })
+		pairs := make([]string, 0, 2*len(pseudonyms))
+		for _, pseudonym := range pseudonyms {
+			pairs = append(pairs, pseudonym, s.reverse[pseudonym])
+		}
+		s.replacer = strings.NewReplacer(pairs...)
+	}
+	replacer := s.replacer
+	s.mu.Unlock()
+
+	return replacer.Replace(text)
+}
+
+// Empty reports whether no pseudonyms have been assigned yet.
+func (s *session) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.forward) == 0
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testInfraPolicy() InfraPolicy {
+	return InfraPolicy{
+		DomainSuffixes: []string{"corp.internal"},
+		CIDRs:          []string{"10.0.0.0/8", "fd00::/8"},
+		Identifiers:    map[string][]string{"aws-account": {"123456789012"}, "project": {"proj-1", "proj-12"}},
+	}
+}
+
+func TestInfraDetect(t *testing.T) {
+	d, err := newInfraDetector(testInfraPolicy())
+	if err != nil {
+		t.Fatalf("newInfraDetector: %v", err)
+	}
+	tests := []struct {
+		text string
+		want []string // rule=secret
+	}{
+		{"ssh db1.corp.internal", []string{"infra-hostname=db1.corp.internal"}},
+		{"curl https://DB1.Corp.Internal/health", []string{"infra-hostname=DB1.Corp.Internal"}},
+		{"db.corp.internal.attacker.com", nil},
+		{"10.1.2.3 and 8.8.8.8", []string{"infra-ip=10.1.2.3"}},
+		{"listen on fd00::1", []string{"infra-ip=fd00::1"}},
+		{"account 123456789012", []string{"infra-aws-account=123456789012"}},
+		{"order 91234567890123", nil},
+		// the longer identifier wins
+		{"see proj-12", []string{"infra-project=proj-12"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, f := range d.Detect(tt.text) {
+			got = append(got, f.RuleID+"="+f.Secret)
+			if f.Action != actionRedact || f.Confidence != 1 {
+				t.Errorf("%q: finding %+v is not a vouched redaction", tt.text, f)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Detect(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+
+	if d, err := newInfraDetector(InfraPolicy{}); d != nil || err != nil {
+		t.Errorf("empty policy: detector = %v, err = %v, want nil", d, err)
+	}
+	if _, err := newInfraDetector(InfraPolicy{CIDRs: []string{"10.0.0.0/33"}}); err == nil {
+		t.Error("newInfraDetector accepted an invalid CIDR")
+	}
+}
+
+func TestSessionPseudonyms(t *testing.T) {
+	store := newSessionStore(time.Hour)
+	s := store.Session("a")
+	findings := s.Apply([]Finding{
+		{RuleID: infraHostRuleID, Secret: "db1.corp.internal"},
+		{RuleID: infraIPRuleID, Secret: "10.1.2.3"},
+		{RuleID: infraHostRuleID, Secret: "db2.corp.internal"},
+		{RuleID: infraRulePrefix + "project", Secret: "proj-1"},
+		{RuleID: "github-pat", Secret: testToken},
+	})
+	want := []string{"host-1.internal.example", "ip-1.internal.example", "host-2.internal.example", "project-1", ""}
+	for i, f := range findings {
+		if f.Replacement != want[i] {
+			t.Errorf("%s: replacement = %q, want %q", f.Secret, f.Replacement, want[i])
+		}
+	}
+
+	// the same identifier keeps its pseudonym
+	again := s.Apply([]Finding{{RuleID: infraHostRuleID, Secret: "db2.corp.internal"}})
+	if again[0].Replacement != "host-2.internal.example" {
+		t.Errorf("replacement = %q, want the earlier pseudonym", again[0].Replacement)
+	}
+
+	// project-12 must not be read as project-1 followed by 2
+	for i := 2; i <= 12; i++ {
+		s.Apply([]Finding{{RuleID: infraRulePrefix + "project", Secret: "proj-" + strings.Repeat("x", i)}})
+	}
+	reversed := s.Reverse("ssh host-2.internal.example; ping ip-1.internal.example; cd project-1 project-12")
+	if want := "ssh db2.corp.internal; ping 10.1.2.3; cd proj-1 proj-xxxxxxxxxxxx"; reversed != want {
+		t.Errorf("Reverse = %q, want %q", reversed, want)
+	}
+
+	// sessions have their own tables
+	other := store.Session("b")
+	if !other.Empty() {
+		t.Error("new session has pseudonyms")
+	}
+	if got := other.Reverse("host-1.internal.example"); got != "host-1.internal.example" {
+		t.Errorf("other session reversed %q", got)
+	}
+}
+
+func TestProxyPseudonymRoundTrip(t *testing.T) {
+	for _, structured := range []bool{false, true} {
+		name := "string"
+		if structured {
+			name = "structured"
+		}
+		t.Run(name, func(t *testing.T) {
+			var forwarded string
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				forwarded = string(body)
+				w.Header().Set("Content-Type", "text/event-stream")
+				io.WriteString(w, "event: content_block_delta\n")
+				io.WriteString(w, `data: {"delta":{"type":"text_delta","text":"ssh host-1.internal.example"}}`+"\n\n")
+			}))
+			defer upstream.Close()
+
+			policy := defaultTestPolicy(t)
+			policy.Infra = testInfraPolicy()
+			p, err := NewProxy(upstream.URL, true, structured, nil, policy, slog.New(slog.DiscardHandler))
+			if err != nil {
+				t.Fatalf("NewProxy: %v", err)
+			}
+			defer p.Close()
+
+			body := `{"metadata":{"user_id":"session-1"},"messages":[{"role":"user","content":"why is db1.corp.internal down?"}]}`
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body)))
+
+			// pseudonyms are not leaks, even with -reject
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			if strings.Contains(forwarded, "db1.corp.internal") || !strings.Contains(forwarded, "host-1.internal.example") {
+				t.Errorf("forwarded body = %s, want the hostname pseudonymized", forwarded)
+			}
+			if got := rec.Body.String(); !strings.Contains(got, `"text":"ssh db1.corp.internal"`) {
+				t.Errorf("response = %q, want the pseudonym mapped back", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zricethezav/gitleaks/v8/detect"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Inspector is one stage of the Scanner's detection pipeline. Stages run in
+// the order given by the policy's inspectors list, each in its own span.
+type Inspector interface {
+	// Name identifies the inspector in the policy, in logs and in spans.
+	Name() string
+	// Inspect returns the findings of the earlier stages, in.Findings, along
+	// with its own. Most inspectors only append; some refine what earlier
+	// stages found instead, such as narrowing a gitleaks match to the
+	// password inside a connection string.
+	// A finding identifies its span of text by its Secret, since redaction
+	// replaces every occurrence of it.
+	Inspect(ctx context.Context, in Inspection) []Finding
+}
+
+// Inspection is the input to an Inspector.
+type Inspection struct {
+	Text     string
+	Location Location
+	// Depth is the number of encodings peeled off to get Text.
+	// Inspectors that only make sense on plain request text skip Depth > 0.
+	Depth int
+	// MaxDepth is how deep to decode, which tool policies can change.
+	MaxDepth int
+	// Findings are the findings of the earlier stages.
+	Findings []Finding
+}
+
+// inspectorFunc adapts a function to the Inspector interface.
+type inspectorFunc struct {
+	name    string
+	inspect func(ctx context.Context, in Inspection) []Finding
+}
+
+func (f inspectorFunc) Name() string { return f.name }
+
+func (f inspectorFunc) Inspect(ctx context.Context, in Inspection) []Finding {
+	return f.inspect(ctx, in)
+}
+
+// appendSpans converts the spans reported by the plugin or external detector
+// called name into findings. Spans without a rule are reported under the
+// detector's own name, without its "wasm:" or "exec:" prefix.
+func appendSpans(findings []Finding, name, text string, spans []pluginSpan, log *slog.Logger) []Finding {
+	for _, s := range spans {
+		// offsets must be bytes; character offsets from a detector that
+		// counts runes usually land inside a multi-byte character
+		if s.Start < 0 || s.End > len(text) || s.Start >= s.End ||
+			!utf8.RuneStart(text[s.Start]) || s.End < len(text) && !utf8.RuneStart(text[s.End]) {
+			log.Warn("detector returned an invalid span", "inspector", name, "start", s.Start, "end", s.End)
+			continue
+		}
+		rule := s.Rule
+		if rule == "" {
+			_, rule, _ = strings.Cut(name, ":")
+		}
+		findings = append(findings, Finding{RuleID: rule, Secret: text[s.Start:s.End]})
+	}
+	return findings
+}
+
+// builtinInspectors returns the inspectors that ship with the proxy, by name.
+// Inspectors that the policy turns off are nil.
+func (s *Scanner) builtinInspectors() map[string]Inspector {
+	inspectors := map[string]Inspector{
+		"gitleaks": inspectorFunc{"gitleaks", func(_ context.Context, in Inspection) []Finding {
+			findings := in.Findings
+			for _, leak := range s.gitleaks.Load().detector.Detect(detect.Fragment{Raw: in.Text}) {
+				findings = append(findings, leakFinding(in.Text, leak))
+			}
+			return findings
+		}},
+		"connection-strings": nil,
+		"key-blocks":         nil,
+		"jwt":                nil,
+		"pii": inspectorFunc{"pii", func(_ context.Context, in Inspection) []Finding {
+			return append(in.Findings, detectPII(s.pii, in.Text)...)
+		}},
+		"decode": inspectorFunc{"decode", func(ctx context.Context, in Inspection) []Finding {
+			if in.Depth >= in.MaxDepth {
+				return in.Findings
+			}
+			return append(in.Findings, s.detectEncoded(ctx, in.Text, in.Location, in.Depth)...)
+		}},
+		"config-files": inspectorFunc{"config-files", func(_ context.Context, in Inspection) []Finding {
+			// only tool results contain the files that tools read
+			if in.Depth > 0 || in.Location.Block != "tool_result" {
+				return in.Findings
+			}
+			return append(in.Findings, s.configFiles.Detect(in.Text)...)
+		}},
+		// registered values are matched in decoded text too, so an encoded
+		// honeytoken still trips
+		"honeytokens": inspectorFunc{"honeytokens", func(_ context.Context, in Inspection) []Finding {
+			return append(in.Findings, s.honeytokens.Detect(in.Text)...)
+		}},
+		"known-secrets": inspectorFunc{"known-secrets", func(_ context.Context, in Inspection) []Finding {
+			return append(in.Findings, s.knownSecrets.Detect(in.Text)...)
+		}},
+		"infra": inspectorFunc{"infra", func(_ context.Context, in Inspection) []Finding {
+			// pseudonyms only make sense for plain text
+			if in.Depth > 0 {
+				return in.Findings
+			}
+			return append(in.Findings, s.infra.Detect(in.Text)...)
+		}},
+	}
+
+	if s.policy.ConnectionStrings.Enabled {
+		inspectors["connection-strings"] = inspectorFunc{"connection-strings", func(_ context.Context, in Inspection) []Finding {
+			findings := narrowToCredentials(in.Text, in.Findings, findCredentials(in.Text))
+			return append(findings, detectConnectionStrings(in.Text)...)
+		}}
+	}
+	if s.policy.KeyBlocks.Enabled {
+		inspectors["key-blocks"] = inspectorFunc{"key-blocks", func(_ context.Context, in Inspection) []Finding {
+			return expandToKeyBlocks(in.Findings, detectKeyBlocks(in.Text))
+		}}
+	}
+	if s.policy.JWT.Enabled {
+		inspectors["jwt"] = inspectorFunc{"jwt", func(_ context.Context, in Inspection) []Finding {
+			return applyJWTPolicy(s.policy.JWT, in.Text, in.Findings)
+		}}
+	}
+
+	return inspectors
+}
+
+// availableInspectors returns the built-in inspectors along with the plugins
+// and external detectors, by name.
+func (s *Scanner) availableInspectors(plugins []Inspector) map[string]Inspector {
+	available := s.builtinInspectors()
+	for _, plugin := range plugins {
+		available[plugin.Name()] = plugin
+	}
+	return available
+}
+
+// buildPipeline resolves the inspector names in the policy, in order.
+// Plugins and external detectors that the policy does not list run after the
+// named inspectors, unless a tool policy lists them for its own calls.
+func (s *Scanner) buildPipeline(available map[string]Inspector, names []string, plugins []Inspector) ([]Inspector, error) {
+	pipeline, err := s.resolveInspectors(available, names, "inspectors")
+	if err != nil {
+		return nil, err
+	}
+	for _, plugin := range plugins {
+		if !slices.Contains(names, plugin.Name()) && !toolOnly(s.policy.Tools, plugin.Name()) {
+			pipeline = append(pipeline, plugin)
+		}
+	}
+	return pipeline, nil
+}
+
+// resolveInspectors looks up names in available, skipping the inspectors the
+// policy turns off. field names the policy setting in errors.
+func (s *Scanner) resolveInspectors(available map[string]Inspector, names []string, field string) ([]Inspector, error) {
+	var inspectors []Inspector
+	for _, name := range names {
+		inspector, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown inspector %q in %s", name, field)
+		}
+		if inspector == nil {
+			s.log.Debug("inspector disabled by policy", "inspector", name)
+			continue
+		}
+		inspectors = append(inspectors, inspector)
+	}
+	return inspectors, nil
+}
+
+// inspect runs the pipeline over text, which is depth encodings deep, and
+// applies the per-rule actions, the policy of the tool call behind loc and
+// the confidence thresholds. Top-level findings are added to the current span
+// as events.
+func (s *Scanner) inspect(ctx context.Context, text string, loc Location, depth int) []Finding {
+	tool := s.toolRuleFor(loc)
+	in := Inspection{Text: text, Location: loc, Depth: depth, MaxDepth: tool.maxDepth(s.policy.Decode.MaxDepth)}
+
+	inspectors := s.inspectors
+	if tool != nil {
+		inspectors = append(slices.Clip(inspectors), tool.inspectors...)
+	}
+	for _, inspector := range inspectors {
+		spanCtx, span := s.tracer.Start(ctx, "inspect "+inspector.Name(), trace.WithAttributes(
+			attribute.String("inspector.name", inspector.Name()),
+			attribute.Int("inspector.depth", depth),
+			attribute.Int("text.length", len(text)),
+		))
+		in.Findings = inspector.Inspect(spanCtx, in)
+		span.SetAttributes(attribute.Int("inspector.findings", len(in.Findings)))
+		span.End()
+	}
+
+	// gitleaks' decoder and ours can both reach the same encoded segment
+	findings := s.applyConfidence(text, tool.apply(s.withActions(dedupeFindings(in.Findings))))
+
+	if depth == 0 {
+		span := trace.SpanFromContext(ctx)
+		for _, f := range findings {
+			span.AddEvent("finding", trace.WithAttributes(
+				attribute.String("finding.rule", f.RuleID),
+				attribute.String("finding.action", f.Action),
+				attribute.Float64("finding.confidence", f.Confidence),
+				attribute.String("finding.block", loc.Block),
+			))
+		}
+	}
+	return findings
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+// recorder is an inspector that adds one finding of its own and records,
+// in order, which inspectors ran and how many findings each was given.
+type recorder struct {
+	name string
+	log  *[]string
+	seen *[]int
+}
+
+func (r recorder) Name() string { return r.name }
+
+func (r recorder) Inspect(_ context.Context, in Inspection) []Finding {
+	*r.log = append(*r.log, r.name)
+	*r.seen = append(*r.seen, len(in.Findings))
+	return append(in.Findings, Finding{RuleID: r.name, Secret: "secret-from-" + r.name})
+}
+
+func TestBuildPipeline(t *testing.T) {
+	policy := defaultTestPolicy(t)
+	policy.JWT.Enabled = false
+	s := newTestScanner(t, policy)
+	s.policy.Tools = []ToolPolicy{{Name: "Bash", Inspectors: []string{"exec:bash-only"}}}
+
+	var log []string
+	var seen []int
+	plugins := []Inspector{
+		recorder{"wasm:unlisted", &log, &seen},
+		recorder{"wasm:listed", &log, &seen},
+		recorder{"exec:bash-only", &log, &seen},
+	}
+	available := s.availableInspectors(plugins)
+
+	pipeline, err := s.buildPipeline(available, []string{"wasm:listed", "gitleaks", "jwt", "pii"}, plugins)
+	if err != nil {
+		t.Fatalf("buildPipeline: %v", err)
+	}
+	var names []string
+	for _, inspector := range pipeline {
+		names = append(names, inspector.Name())
+	}
+	// jwt is turned off, unlisted plugins run last, and a plugin a tool
+	// policy lists only runs for that tool
+	if want := []string{"wasm:listed", "gitleaks", "pii", "wasm:unlisted"}; !slices.Equal(names, want) {
+		t.Errorf("pipeline = %v, want %v", names, want)
+	}
+
+	if _, err := s.buildPipeline(available, []string{"gitleaks", "no-such-inspector"}, plugins); err == nil {
+		t.Error("buildPipeline accepted an unknown inspector")
+	}
+}
+
+func TestInspectRunsPipelineInOrder(t *testing.T) {
+	s := newTestScanner(t, defaultTestPolicy(t))
+	var log []string
+	var seen []int
+	s.inspectors = []Inspector{
+		recorder{"first", &log, &seen},
+		recorder{"second", &log, &seen},
+		recorder{"third", &log, &seen},
+	}
+	tools, err := s.newToolRules([]ToolPolicy{{Name: "Bash", Inspectors: []string{"tool"}}},
+		map[string]Inspector{"tool": recorder{"tool", &log, &seen}})
+	if err != nil {
+		t.Fatalf("newToolRules: %v", err)
+	}
+	s.tools = tools
+
+	findings := s.Scan(t.Context(), "nothing else here", Location{Block: "text"}).Findings
+	if want := []string{"first", "second", "third"}; !slices.Equal(log, want) {
+		t.Errorf("ran %v, want %v", log, want)
+	}
+	// each stage is given the findings of the stages before it
+	if want := []int{0, 1, 2}; !slices.Equal(seen, want) {
+		t.Errorf("findings given = %v, want %v", seen, want)
+	}
+	if len(findings) != 3 {
+		t.Errorf("findings = %+v, want one per stage", findings)
+	}
+
+	// a tool policy's inspectors run after the pipeline, for its calls only
+	log, seen = nil, nil
+	s.Scan(t.Context(), "nothing else here", Location{Block: "tool_result", ToolName: "Bash", Target: "env"})
+	if want := []string{"first", "second", "third", "tool"}; !slices.Equal(log, want) {
+		t.Errorf("ran %v for a Bash result, want %v", log, want)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// jwtRuleID is reported for JWTs that the policy says to redact.
+const jwtRuleID = "jwt"
+
+// header.payload.signature, where header and payload are base64url JSON objects
+var jwtPattern = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{2,}\.eyJ[A-Za-z0-9_-]{2,}\.[A-Za-z0-9_-]*`)
+
+// jwtClaims are the registered claims the policy can act on.
+type jwtClaims struct {
+	Issuer    string
+	Audience  []string
+	ExpiresAt time.Time // zero if the token has no exp claim
+}
+
+// Expired reports whether the token has an exp claim in the past.
+func (c jwtClaims) Expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && c.ExpiresAt.Before(now)
+}
+
+// parseJWT decodes the payload of a JWT without verifying its signature.
+func parseJWT(token string) (jwtClaims, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return jwtClaims{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return jwtClaims{}, false
+	}
+
+	var raw struct {
+		Iss string          `json:"iss"`
+		Aud json.RawMessage `json:"aud"`
+		Exp json.Number     `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return jwtClaims{}, false
+	}
+
+	claims := jwtClaims{Issuer: raw.Iss}
+
+	// aud is either a single string or an array of strings
+	var aud string
+	if err := json.Unmarshal(raw.Aud, &aud); err == nil {
+		claims.Audience = []string{aud}
+	} else {
+		_ = json.Unmarshal(raw.Aud, &claims.Audience)
+	}
+
+	if exp, err := raw.Exp.Float64(); err == nil {
+		claims.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+
+	return claims, true
+}
+
+// applyJWTPolicy decodes every JWT in text and decides whether it is redacted.
+// Findings from other detectors that fall inside a JWT, such as the gitleaks
+// jwt rule, are replaced by the policy's decision, so an allowed token is not
+// redacted by a rule that cannot see its claims. A finding is only replaced
+// when every occurrence of its secret in text lies inside a token; one that
+// also occurs elsewhere is kept.
+func applyJWTPolicy(policy JWTPolicy, text string, findings []Finding) []Finding {
+	now := time.Now()
+
+	var spans [][]int
+	var decided []Finding
+	for _, span := range jwtPattern.FindAllStringIndex(text, -1) {
+		token := text[span[0]:span[1]]
+		claims, ok := parseJWT(token)
+		if !ok {
+			continue
+		}
+		spans = append(spans, span)
+
+		if !redactJWT(policy, claims, now) {
+			continue
+		}
+		decided = append(decided, Finding{
+			RuleID:     jwtRuleID,
+			Secret:     token,
+			Detail:     jwtDetail(claims),
+			Confidence: 1,
+		})
+	}
+	if len(spans) == 0 {
+		return findings
+	}
+
+	findings = slices.DeleteFunc(findings, func(f Finding) bool {
+		return insideSpans(text, f.Secret, spans)
+	})
+	return append(findings, decided...)
+}
+
+// insideSpans reports whether secret occurs in text, and every occurrence
+// lies inside one of spans.
+func insideSpans(text, secret string, spans [][]int) bool {
+	if secret == "" {
+		return false
+	}
+	found := false
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], secret)
+		if i < 0 {
+			return found
+		}
+		start := offset + i
+		end := start + len(secret)
+		if !slices.ContainsFunc(spans, func(span []int) bool { return span[0] <= start && end <= span[1] }) {
+			return false
+		}
+		found = true
+		offset = start + 1
+	}
+}
+
+// redactJWT evaluates the policy against a token's claims. Issuers listed in
+// AlwaysRedactIssuers win over everything else.
+func redactJWT(policy JWTPolicy, claims jwtClaims, now time.Time) bool {
+	if slices.Contains(policy.AlwaysRedactIssuers, claims.Issuer) {
+		return true
+	}
+	if claims.Issuer != "" && slices.Contains(policy.AllowIssuers, claims.Issuer) {
+		return false
+	}
+	for _, aud := range claims.Audience {
+		if slices.Contains(policy.AllowAudiences, aud) {
+			return false
+		}
+	}
+	if policy.AllowExpired && claims.Expired(now) {
+		return false
+	}
+	return true
+}
+
+// jwtDetail describes a token by its claims, never by its value.
+func jwtDetail(claims jwtClaims) string {
+	detail := "iss=" + claims.Issuer
+	if len(claims.Audience) > 0 {
+		detail += " aud=" + strings.Join(claims.Audience, ",")
+	}
+	if !claims.ExpiresAt.IsZero() {
+		detail += fmt.Sprintf(" exp=%s", claims.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return detail
+}
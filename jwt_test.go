@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/base64"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testJWT builds an unsigned-looking token with the given payload.
+func testJWT(payload string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(payload)) + ".c2lnbmF0dXJlX3ZhbHVl"
+}
+
+func TestParseJWT(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		want    jwtClaims
+		wantErr bool
+	}{
+		{
+			name:  "string audience",
+			token: testJWT(`{"iss":"https://auth.example.com","aud":"api","exp":1700000000}`),
+			want:  jwtClaims{Issuer: "https://auth.example.com", Audience: []string{"api"}, ExpiresAt: time.Unix(1700000000, 0)},
+		},
+		{
+			name:  "audience list without exp",
+			token: testJWT(`{"iss":"idp","aud":["a","b"]}`),
+			want:  jwtClaims{Issuer: "idp", Audience: []string{"a", "b"}},
+		},
+		{
+			name:  "padded payload",
+			token: "eyJhbGciOiJIUzI1NiJ9." + base64.URLEncoding.EncodeToString([]byte(`{"iss":"x"}`)) + ".sig",
+			want:  jwtClaims{Issuer: "x"},
+		},
+		{name: "two parts", token: "eyJhbGciOiJIUzI1NiJ9.eyJpc3MiOiJ4In0", wantErr: true},
+		{name: "payload not JSON", token: "eyJhbGciOiJIUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte("nope")) + ".sig", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseJWT(tt.token)
+			if ok == tt.wantErr {
+				t.Fatalf("parseJWT ok = %v, want %v", ok, !tt.wantErr)
+			}
+			if got.Issuer != tt.want.Issuer || !slices.Equal(got.Audience, tt.want.Audience) || !got.ExpiresAt.Equal(tt.want.ExpiresAt) {
+				t.Errorf("parseJWT = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyJWTPolicy(t *testing.T) {
+	exp := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	live := testJWT(`{"iss":"prod","aud":"api","exp":` + exp + `}`)
+	expired := testJWT(`{"iss":"prod","exp":1000}`)
+	expiredCritical := testJWT(`{"iss":"critical","exp":1000}`)
+	allowedIssuer := testJWT(`{"iss":"test-idp","exp":` + exp + `}`)
+	allowedAudience := testJWT(`{"iss":"prod","aud":["fixtures"],"exp":` + exp + `}`)
+
+	policy := JWTPolicy{
+		Enabled:             true,
+		AllowExpired:        true,
+		AlwaysRedactIssuers: []string{"critical"},
+		AllowIssuers:        []string{"test-idp"},
+		AllowAudiences:      []string{"fixtures"},
+	}
+	tests := []struct {
+		name   string
+		token  string
+		redact bool
+	}{
+		{"live token", live, true},
+		{"expired", expired, false},
+		{"always redacted issuer", expiredCritical, true},
+		{"allowed issuer", allowedIssuer, false},
+		{"allowed audience", allowedAudience, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the gitleaks jwt rule's finding is replaced by the policy's decision
+			gitleaks := []Finding{{RuleID: "jwt", Secret: tt.token}}
+			got := applyJWTPolicy(policy, "Authorization: Bearer "+tt.token, gitleaks)
+			if !tt.redact {
+				if len(got) != 0 {
+					t.Errorf("findings = %v, want none", got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].RuleID != jwtRuleID || got[0].Secret != tt.token || got[0].Confidence != 1 {
+				t.Errorf("findings = %v, want one jwt finding for the token", got)
+			}
+		})
+	}
+}
+
+func TestApplyJWTPolicyKeepsFindingsOutsideTokens(t *testing.T) {
+	policy := JWTPolicy{Enabled: true, AllowExpired: true}
+	expired := testJWT(`{"iss":"prod","exp":1000}`)
+	// a short secret that also happens to occur inside the token's signature
+	inside := "bmF0dXJl"
+	text := "token " + expired + " and key=" + inside
+	findings := []Finding{
+		{RuleID: "jwt", Secret: expired},
+		{RuleID: "generic-api-key", Secret: inside},
+	}
+	got := applyJWTPolicy(policy, text, findings)
+	var rules []string
+	for _, f := range got {
+		rules = append(rules, f.RuleID)
+	}
+	if want := []string{"generic-api-key"}; !slices.Equal(rules, want) {
+		t.Errorf("rules = %v, want %v", rules, want)
+	}
+}
+
+func TestJWTAllowExpiredDefault(t *testing.T) {
+	policy := defaultTestPolicy(t)
+	if policy.JWT.AllowExpired {
+		t.Fatal("jwt.allow_expired is on by default")
+	}
+	expired := testJWT(`{"iss":"prod","exp":1000}`)
+	got := applyJWTPolicy(policy.JWT, expired, nil)
+	if len(got) != 1 || got[0].Secret != expired {
+		t.Errorf("findings = %v, want the expired token redacted", got)
+	}
+}
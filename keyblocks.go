@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// keyBlockRuleID is reported for private key blocks that no gitleaks rule matched.
+const keyBlockRuleID = "private-key-block"
+
+var (
+	armorBegin = regexp.MustCompile(`-----BEGIN ([A-Z0-9 ]+)-----`)
+	// Single-line base64 DER, as in a Kubernetes `tls.pfx:` value. PKCS#12
+	// files are large enough to always use a long-form SEQUENCE length.
+	pkcs12Base64 = regexp.MustCompile(`\bMII[A-Za-z0-9+/]{60,}={0,2}`)
+
+	oidPKCS7Data       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// detectKeyBlocks finds private keys and PKCS#12 bundles that span multiple
+// lines: PEM and OpenSSH private keys, PGP private key blocks and base64
+// PKCS#12. Each candidate must parse, so examples and truncated keys in
+// documentation are left alone. Public certificates are not reported.
+//
+// The finding covers the whole block from BEGIN to END, and its replacement
+// keeps the key type so the model can still tell what was there.
+func detectKeyBlocks(text string) []Finding {
+	var findings []Finding
+
+	for _, m := range armorBegin.FindAllStringSubmatchIndex(text, -1) {
+		label := text[m[2]:m[3]]
+		if !strings.Contains(label, "PRIVATE KEY") {
+			continue
+		}
+		endMarker := "-----END " + label + "-----"
+		end := strings.Index(text[m[1]:], endMarker)
+		if end < 0 {
+			continue
+		}
+		block := text[m[0] : m[1]+end+len(endMarker)]
+
+		if !validKeyBlock(label, normalizeBlock(block)) {
+			continue
+		}
+		findings = append(findings, Finding{
+			RuleID:      keyBlockRuleID,
+			Secret:      block,
+			Replacement: "<REDACTED:" + label + ">",
+			Confidence:  1,
+		})
+	}
+
+	for _, encoded := range pkcs12Base64.FindAllString(text, -1) {
+		der, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || !isPKCS12(der) {
+			continue
+		}
+		findings = append(findings, Finding{
+			RuleID:      keyBlockRuleID,
+			Secret:      encoded,
+			Replacement: "<REDACTED:PKCS12>",
+			Confidence:  1,
+		})
+	}
+
+	return findings
+}
+
+// expandToKeyBlocks widens findings that only cover part of a key block, such
+// as a gitleaks private-key match on a line-numbered Read result, to the whole
+// block. Blocks that no finding touched are appended as their own findings.
+func expandToKeyBlocks(findings, blocks []Finding) []Finding {
+	covered := make([]bool, len(blocks))
+	for i, f := range findings {
+		if len(f.Encodings) > 0 {
+			continue
+		}
+		for j, b := range blocks {
+			if strings.Contains(b.Secret, f.Secret) || strings.Contains(f.Secret, b.Secret) {
+				findings[i].Secret = b.Secret
+				findings[i].Replacement = b.Replacement
+				findings[i].Confidence = b.Confidence
+				covered[j] = true
+				break
+			}
+		}
+	}
+	for j, b := range blocks {
+		if !covered[j] {
+			findings = append(findings, b)
+		}
+	}
+	return findings
+}
+
+// normalizeBlock undoes the ways a key block gets mangled on its way into a
+// request: JSON-escaped newlines, Read tool line numbers and indentation.
+func normalizeBlock(block string) string {
+	if !strings.Contains(block, "\n") {
+		block = strings.ReplaceAll(block, `\n`, "\n")
+	}
+	lines := strings.Split(block, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(lineNumberPrefix.ReplaceAllString(line, ""))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validKeyBlock parses a normalized armored block according to its label.
+func validKeyBlock(label, block string) bool {
+	if strings.HasPrefix(label, "PGP ") {
+		return validPGPBlock(block)
+	}
+
+	p, _ := pem.Decode([]byte(block))
+	if p == nil || len(p.Bytes) == 0 {
+		return false
+	}
+
+	if label == "ENCRYPTED PRIVATE KEY" {
+		// PKCS#8 EncryptedPrivateKeyInfo, which ssh cannot parse without the passphrase
+		var info struct {
+			Algorithm pkix.AlgorithmIdentifier
+			Data      []byte
+		}
+		_, err := asn1.Unmarshal(p.Bytes, &info)
+		return err == nil
+	}
+
+	// Handles PKCS#1, PKCS#8, SEC 1 EC, DSA and OpenSSH keys
+	_, err := ssh.ParseRawPrivateKey([]byte(block))
+	var missing *ssh.PassphraseMissingError
+	return err == nil || errors.As(err, &missing)
+}
+
+// validPGPBlock checks that the armored body decodes to an OpenPGP packet.
+// Armor headers and the trailing =CRC24 checksum line are skipped.
+func validPGPBlock(block string) bool {
+	lines := strings.Split(block, "\n")
+	if len(lines) < 3 {
+		return false
+	}
+
+	var body strings.Builder
+	inBody := false
+	for _, line := range lines[1 : len(lines)-1] {
+		switch {
+		case !inBody && (line == "" || strings.Contains(line, ": ")):
+			// armor headers end at the first blank line
+			inBody = line == ""
+		case strings.HasPrefix(line, "="):
+			// checksum
+		default:
+			inBody = true
+			body.WriteString(line)
+		}
+	}
+
+	data, err := base64.StdEncoding.DecodeString(body.String())
+	// every OpenPGP packet header has its top bit set
+	return err == nil && len(data) > 0 && data[0]&0x80 != 0
+}
+
+// isPKCS12 checks the outer structure of a PKCS#12 PFX: a SEQUENCE of
+// version 3 and a PKCS#7 data or signed-data ContentInfo.
+func isPKCS12(der []byte) bool {
+	var pfx struct {
+		Version  int
+		AuthSafe struct {
+			ContentType asn1.ObjectIdentifier
+			Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+		}
+		MacData asn1.RawValue `asn1:"optional"`
+	}
+	if _, err := asn1.Unmarshal(der, &pfx); err != nil {
+		return false
+	}
+	contentType := pfx.AuthSafe.ContentType
+	return pfx.Version == 3 && (contentType.Equal(oidPKCS7Data) || contentType.Equal(oidPKCS7SignedData))
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	ahocorasick "github.com/BobuSumisu/aho-corasick"
+)
+
+// Registry findings are reported as "<registry>:<entry name>" instead of a
+// gitleaks rule ID.
+const (
+	knownSecretRuleID = "known-secret"
+	honeytokenRuleID  = "honeytoken"
+)
+
+// knownSecretLine is a NAME=value line in a known-secrets source. The name
+// must be an identifier and the value must not start with '=', so a bare
+// base64 value with padding is not mistaken for an assignment.
+var knownSecretLine = regexp.MustCompile(`^(?:export\s+)?([A-Za-z_][A-Za-z0-9_]*)\s*=\s*([^=\s].*?)\s*$`)
+
+// minBase64Fragment is the shortest part of a value's base64 encoding that
+// is matched on its own. Shorter fragments would match unrelated base64.
+const minBase64Fragment = 8
+
+// knownSecret is one registry entry, as matched by one trie pattern. Only the
+// hash of the value is kept alongside the matcher, so the registry can be
+// listed and logged safely.
+type knownSecret struct {
+	name string
+	hash string
+	// inBase64 marks a pattern cut from the middle of the value's base64
+	// encoding. Its matches are widened to the whole base64 run, which is
+	// redacted as a unit.
+	inBase64 bool
+}
+
+// knownSecrets is a registry of exact secret values, such as internal database
+// passwords, that have no recognisable pattern. Values are loaded from files,
+// environment variables and the output of a local command, and are matched
+// with an Aho-Corasick trie regardless of gitleaks rules.
+// The same registry type holds the honeytoken list.
+type knownSecrets struct {
+	name   string
+	policy KnownSecretsPolicy
+	log    *slog.Logger
+
+	mu      sync.RWMutex
+	trie    *ahocorasick.Trie
+	entries []knownSecret // indexed by trie pattern
+}
+
+// newKnownSecrets loads a registry. name is used as the rule ID prefix of its findings.
+func newKnownSecrets(name string, policy KnownSecretsPolicy, logger *slog.Logger) (*knownSecrets, error) {
+	k := &knownSecrets{name: name, policy: policy, log: logger.With("component", name)}
+	if err := k.Load(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Load (re)reads every configured source and atomically swaps in the new matcher.
+// On error the previous registry stays active.
+func (k *knownSecrets) Load() error {
+	values := make(map[string]string) // value -> entry name
+
+	for _, path := range k.policy.Files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read %s file %s: %w", k.name, path, err)
+		}
+		parseKnownSecrets(path, string(data), values)
+	}
+
+	for _, name := range k.policy.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			values[value] = name
+		}
+	}
+
+	if len(k.policy.Command) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, k.policy.Command[0], k.policy.Command[1:]...)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("run %s command %s: %w", k.name, k.policy.Command[0], err)
+		}
+		parseKnownSecrets(k.policy.Command[0], string(out), values)
+	}
+
+	var patterns []string
+	var entries []knownSecret
+	for value, name := range values {
+		if len(value) < k.policy.MinLength {
+			k.log.Warn("skipping entry: too short", "name", name, "length", len(value))
+			continue
+		}
+		sum := sha256.Sum256([]byte(value))
+		entry := knownSecret{name: name, hash: hex.EncodeToString(sum[:])}
+
+		k.log.Debug("registered entry", "name", name, "sha256", entry.hash[:12])
+
+		patterns = append(patterns, value)
+		entries = append(entries, entry)
+
+		// Secrets with quotes, backslashes or HTML characters are escaped
+		// inside JSON request bodies, and may be URL-encoded in a query
+		for _, escaped := range append(jsonEscapes(value), urlEscapes(value)...) {
+			patterns = append(patterns, escaped)
+			entries = append(entries, entry)
+		}
+
+		// A honeytoken in a Basic auth header or a base64 blob is still a
+		// honeytoken
+		for _, fragment := range base64Fragments(value) {
+			patterns = append(patterns, fragment)
+			entries = append(entries, knownSecret{name: name, hash: entry.hash, inBase64: true})
+		}
+	}
+
+	trie := ahocorasick.NewTrieBuilder().AddStrings(patterns).Build()
+
+	k.mu.Lock()
+	k.trie = trie
+	k.entries = entries
+	k.mu.Unlock()
+
+	k.log.Info("loaded registry", "count", len(values))
+	return nil
+}
+
+// Detect returns a finding for every occurrence of a registered secret in text.
+func (k *knownSecrets) Detect(text string) []Finding {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.entries) == 0 {
+		return nil
+	}
+
+	var findings []Finding
+	for _, m := range k.trie.MatchString(text) {
+		entry := k.entries[m.Pattern()]
+		secret := m.MatchString()
+		if entry.inBase64 {
+			start := int(m.Pos())
+			secret = base64Run(text, start, start+len(secret))
+		}
+		findings = append(findings, Finding{
+			RuleID:     k.name + ":" + entry.name,
+			Secret:     secret,
+			Confidence: 1,
+		})
+	}
+	return findings
+}
+
+// base64Run widens text[start:end] to the run of base64 characters, in the
+// standard or URL alphabet, around it, with its padding.
+func base64Run(text string, start, end int) string {
+	isBase64 := func(c byte) bool {
+		return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '+' || c == '/' || c == '-' || c == '_'
+	}
+	for start > 0 && isBase64(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isBase64(text[end]) {
+		end++
+	}
+	for i := 0; i < 2 && end < len(text) && text[end] == '='; i++ {
+		end++
+	}
+	return text[start:end]
+}
+
+// parseKnownSecrets reads NAME=value, `name: value` or bare value lines.
+// Bare values, and lines that only look like assignments, are registered
+// whole and named after their source and line number.
+func parseKnownSecrets(source, data string, values map[string]string) {
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		m := knownSecretLine.FindStringSubmatch(text)
+		if m == nil {
+			m = yamlLine.FindStringSubmatch(text)
+		}
+		if m != nil {
+			if value := unquote(m[2]); value != "" {
+				values[value] = m[1]
+			}
+			continue
+		}
+
+		values[text] = fmt.Sprintf("%s:%d", source, line)
+	}
+}
+
+// urlEscapes returns the percent-encoded forms of value, in a query and in a
+// path, that differ from value itself.
+func urlEscapes(value string) []string {
+	var escapes []string
+	for _, escaped := range []string{url.QueryEscape(value), url.PathEscape(value)} {
+		if escaped != value && !slices.Contains(escapes, escaped) {
+			escapes = append(escapes, escaped)
+		}
+	}
+	return escapes
+}
+
+// base64Fragments returns the parts of value's base64 encoding that do not
+// depend on what surrounds it. Encoded inside a longer blob, value can start
+// at any of three positions within a 3-byte group; for each, the characters
+// that only cover bits of value are the same wherever it sits. Both the
+// standard and the URL alphabet are included.
+func base64Fragments(value string) []string {
+	var fragments []string
+	for offset := range 3 {
+		encoded := base64.RawStdEncoding.EncodeToString(append(make([]byte, offset), value...))
+		bits := 8 * offset
+		start := (bits + 5) / 6
+		end := (bits + 8*len(value)) / 6
+		if end-start < minBase64Fragment {
+			continue
+		}
+		fragment := encoded[start:end]
+		for _, f := range []string{fragment, strings.NewReplacer("+", "-", "/", "_").Replace(fragment)} {
+			if !slices.Contains(fragments, f) {
+				fragments = append(fragments, f)
+			}
+		}
+	}
+	return fragments
+}
+
+// jsonEscapes returns the forms value can take inside a JSON string, with and
+// without HTML escaping, that differ from value itself.
+func jsonEscapes(value string) []string {
+	var escapes []string
+	for _, escapeHTML := range []bool{false, true} {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(escapeHTML)
+		if err := enc.Encode(value); err != nil {
+			continue
+		}
+		// strip the quotes and the trailing newline added by Encode
+		escaped := strings.TrimSuffix(buf.String(), "\n")
+		escaped = escaped[1 : len(escaped)-1]
+		if escaped != value && !slices.Contains(escapes, escaped) {
+			escapes = append(escapes, escaped)
+		}
+	}
+	return escapes
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/zricethezav/gitleaks/v8/config"
+	"github.com/zricethezav/gitleaks/v8/detect"
+)
+
+// defaultLayer names the gitleaks config built into the binary.
+const defaultLayer = "default"
+
+// maxExtendDepth is how many [extend] path links a layer may follow, the same
+// limit gitleaks has.
+const maxExtendDepth = 2
+
+// layeredConfig is the gitleaks config merged from every layer, with a record
+// of where each rule came from.
+type layeredConfig struct {
+	Config config.Config
+	// Layers are the layers that were merged, in order.
+	Layers []string
+	// Sources lists, per rule ID, the layer that added the rule followed by
+	// the layers that changed it.
+	Sources map[string][]string
+	// Warnings are problems that did not stop the config from loading, such
+	// as disabling a rule no earlier layer defines.
+	Warnings []string
+	// Hash identifies the contents of every layer, to tell reloads apart.
+	Hash string
+}
+
+// gitleaksEngine is a gitleaks detector along with the config it was built
+// from. The Scanner swaps it as a whole when the config is reloaded.
+type gitleaksEngine struct {
+	detector *detect.Detector
+	rules    layeredConfig
+}
+
+// newGitleaksEngine loads the configs at paths, then the overlay, and builds a
+// detector. A config without rules is rejected, since it is most likely a file
+// caught halfway through being saved.
+func newGitleaksEngine(paths []string, overlay string, maxDecodeDepth int) (*gitleaksEngine, error) {
+	cfg, err := loadGitleaksConfig(paths, overlay)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Config.Rules) == 0 {
+		return nil, errors.New("gitleaks config has no rules")
+	}
+	detector := detect.NewDetector(cfg.Config)
+	detector.MaxDecodeDepth = maxDecodeDepth
+	return &gitleaksEngine{detector: detector, rules: cfg}, nil
+}
+
+// gitleaksLayer is one config file, parsed but not yet translated.
+type gitleaksLayer struct {
+	name string
+	vc   config.ViperConfig
+}
+
+// loadGitleaksConfig merges the gitleaks configs at paths, in order, usually
+// an org-wide baseline, a team file and a project's .gitleaks.toml. Later
+// layers add rules, change rules by ID (their allowlists, keywords and tags
+// are appended, everything else replaced) and disable rules from earlier
+// layers with [extend] disabledRules. The built-in rules are the first layer
+// if no paths are given or any layer sets [extend] useDefault, as gitleaks
+// does for a single file. A layer that sets [extend] path is preceded by the
+// file it extends. The overlay, if set, is the last layer; see
+// readGitleaksLayers.
+func loadGitleaksConfig(paths []string, overlay string) (layeredConfig, error) {
+	layers, hash, err := readGitleaksLayers(paths, overlay)
+	if err != nil {
+		return layeredConfig{}, err
+	}
+	merged, result := mergeGitleaksLayers(layers)
+	if err := validateRegexes(merged); err != nil {
+		return layeredConfig{}, err
+	}
+	cfg, err := merged.Translate()
+	if err != nil {
+		return layeredConfig{}, fmt.Errorf("translate config: %w", err)
+	}
+	result.Config = cfg
+	result.Hash = hash
+	return result, nil
+}
+
+// readGitleaksLayers reads the configs at paths, preceded by the default
+// layer when it is used, and hashes their contents. The overlay is the
+// managed config feedback writes to: it is read after them if it exists,
+// does not decide whether the default layer is used and cannot extend
+// another file.
+func readGitleaksLayers(paths []string, overlay string) ([]gitleaksLayer, string, error) {
+	var layers []gitleaksLayer
+	useDefault := len(paths) == 0
+	hash := sha256.New()
+	for _, path := range paths {
+		extended, err := readGitleaksChain(path, hash, 0)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, layer := range extended {
+			useDefault = useDefault || layer.vc.Extend.UseDefault
+		}
+		layers = append(layers, extended...)
+	}
+	if useDefault {
+		vc, err := readGitleaksLayer(config.DefaultConfig)
+		if err != nil {
+			return nil, "", fmt.Errorf("load default config: %w", err)
+		}
+		layers = append([]gitleaksLayer{{name: defaultLayer, vc: vc}}, layers...)
+	}
+	if overlay != "" {
+		layer, err := readGitleaksFile(overlay, hash)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, "", err
+		}
+		if err == nil && layer.vc.Extend.Path != "" {
+			return nil, "", fmt.Errorf("load config from %s: the overlay cannot set [extend] path", overlay)
+		}
+		if err == nil {
+			layers = append(layers, layer)
+		}
+	}
+	// the default layer is fixed for a given binary
+	return layers, hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
+
+// readGitleaksChain reads the config at path, preceded by the configs it
+// extends with [extend] path, depth links into the chain. As in gitleaks, the
+// extended path is used as written, so a relative one is resolved from the
+// working directory.
+func readGitleaksChain(path string, hash io.Writer, depth int) ([]gitleaksLayer, error) {
+	layer, err := readGitleaksFile(path, hash)
+	if err != nil {
+		return nil, err
+	}
+	extend := layer.vc.Extend
+	if extend.Path == "" {
+		return []gitleaksLayer{layer}, nil
+	}
+	if extend.UseDefault {
+		return nil, fmt.Errorf("load config from %s: [extend] path and useDefault cannot both be set", path)
+	}
+	if depth == maxExtendDepth {
+		return nil, fmt.Errorf("load config from %s: [extend] path is more than %d levels deep", path, maxExtendDepth)
+	}
+	base, err := readGitleaksChain(extend.Path, hash, depth+1)
+	if err != nil {
+		return nil, fmt.Errorf("extend %s: %w", path, err)
+	}
+	return append(base, layer), nil
+}
+
+// readGitleaksFile reads the config at path as a layer, adding it to hash.
+func readGitleaksFile(path string, hash io.Writer) (gitleaksLayer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return gitleaksLayer{}, fmt.Errorf("load config from %s: %w", path, err)
+	}
+	fmt.Fprintf(hash, "%s\x00%s\x00", path, data)
+	vc, err := readGitleaksLayer(string(data))
+	if err != nil {
+		return gitleaksLayer{}, fmt.Errorf("load config from %s: %w", path, err)
+	}
+	if vc.Extend.URL != "" {
+		return gitleaksLayer{}, fmt.Errorf("load config from %s: [extend] url is not supported, download the file and use [extend] path", path)
+	}
+	return gitleaksLayer{name: path, vc: vc}, nil
+}
+
+// readGitleaksLayer parses one gitleaks config.
+func readGitleaksLayer(data string) (config.ViperConfig, error) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	if err := v.ReadConfig(strings.NewReader(data)); err != nil {
+		return config.ViperConfig{}, fmt.Errorf("read config: %w", err)
+	}
+
+	var vc config.ViperConfig
+	if err := v.Unmarshal(&vc); err != nil {
+		return config.ViperConfig{}, fmt.Errorf("unmarshal config: %w", err)
+	}
+	return vc, nil
+}
+
+// mergeGitleaksLayers folds the layers into one config, the way gitleaks
+// merges an extended config into its base, but before translation so that a
+// layer may change a rule it does not fully define.
+func mergeGitleaksLayers(layers []gitleaksLayer) (config.ViperConfig, layeredConfig) {
+	var merged config.ViperConfig
+	result := layeredConfig{Sources: make(map[string][]string)}
+	index := make(map[string]int) // rule ID -> position in merged.Rules
+
+	for _, layer := range layers {
+		result.Layers = append(result.Layers, layer.name)
+		vc := layer.vc
+
+		for _, id := range vc.Extend.DisabledRules {
+			i, ok := index[id]
+			if !ok {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%s: disabled rule %q is not defined by an earlier layer", layer.name, id))
+				continue
+			}
+			merged.Rules[i].ID = "" // dropped below
+			delete(index, id)
+			delete(result.Sources, id)
+		}
+
+		for _, rule := range vc.Rules {
+			// the deprecated single allowlist, which cannot be combined
+			// with the allowlists of another layer otherwise
+			if rule.AllowList != nil {
+				rule.Allowlists = append(rule.Allowlists, rule.AllowList)
+				rule.AllowList = nil
+			}
+
+			i, ok := index[rule.ID]
+			if !ok {
+				index[rule.ID] = len(merged.Rules)
+				merged.Rules = append(merged.Rules, rule)
+				result.Sources[rule.ID] = []string{layer.name}
+				continue
+			}
+
+			base := &merged.Rules[i]
+			if rule.Description != "" {
+				base.Description = rule.Description
+			}
+			if rule.Regex != "" {
+				base.Regex = rule.Regex
+			}
+			if rule.Path != "" {
+				base.Path = rule.Path
+			}
+			if rule.SecretGroup != 0 {
+				base.SecretGroup = rule.SecretGroup
+			}
+			if rule.Entropy != 0 {
+				base.Entropy = rule.Entropy
+			}
+			base.SkipReport = base.SkipReport || rule.SkipReport
+			base.Keywords = append(base.Keywords, rule.Keywords...)
+			base.Tags = append(base.Tags, rule.Tags...)
+			base.Allowlists = append(base.Allowlists, rule.Allowlists...)
+			base.Required = append(base.Required, rule.Required...)
+			result.Sources[rule.ID] = append(result.Sources[rule.ID], layer.name)
+		}
+
+		if vc.AllowList != nil {
+			merged.Allowlists = append(merged.Allowlists, vc.AllowList)
+		}
+		merged.Allowlists = append(merged.Allowlists, vc.Allowlists...)
+
+		if vc.Title != "" {
+			merged.Title = vc.Title
+		}
+		if vc.Description != "" {
+			merged.Description = vc.Description
+		}
+		if vc.MinVersion != "" {
+			merged.MinVersion = vc.MinVersion
+		}
+	}
+
+	rules := merged.Rules[:0]
+	for _, rule := range merged.Rules {
+		if rule.ID != "" {
+			rules = append(rules, rule)
+		}
+	}
+	merged.Rules = rules
+	return merged, result
+}
+
+// validateRegexes compiles every pattern in the config, since Translate
+// panics on an invalid one.
+func validateRegexes(vc config.ViperConfig) error {
+	for _, rule := range vc.Rules {
+		patterns := []string{rule.Regex, rule.Path}
+		for _, allowlist := range rule.Allowlists {
+			patterns = append(patterns, allowlist.Regexes...)
+			patterns = append(patterns, allowlist.Paths...)
+		}
+		if err := compilePatterns(patterns); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+	}
+	for _, allowlist := range vc.Allowlists {
+		if err := compilePatterns(slices.Concat(allowlist.Regexes, allowlist.Paths)); err != nil {
+			return fmt.Errorf("allowlist: %w", err)
+		}
+	}
+	return nil
+}
+
+func compilePatterns(patterns []string) error {
+	if errs := patternErrors(patterns); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// lowEntropy is the Shannon entropy below which a rule's threshold lets
+// through most random-looking strings, placeholders included.
+const lowEntropy = 2.0
+
+// lintGitleaksConfig looks for mistakes in the rules that layers other than
+// the built-in one add or change: invalid patterns and required rules that
+// do not exist are errors; rules without keywords, low entropy thresholds
+// and rules defined twice in one file are warnings. Unlike validateRegexes
+// it reports every problem rather than the first.
+func lintGitleaksConfig(layers []gitleaksLayer, merged config.ViperConfig, cfg layeredConfig) (errs, warnings []string) {
+	for _, layer := range layers {
+		if layer.name == defaultLayer {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, rule := range layer.vc.Rules {
+			if seen[rule.ID] {
+				warnings = append(warnings, fmt.Sprintf("%s: rule %s is defined more than once, the definitions are merged", layer.name, rule.ID))
+			}
+			seen[rule.ID] = true
+		}
+		for i, allowlist := range layer.vc.Allowlists {
+			for _, err := range patternErrors(slices.Concat(allowlist.Regexes, allowlist.Paths)) {
+				errs = append(errs, fmt.Sprintf("%s: allowlists[%d]: %v", layer.name, i, err))
+			}
+		}
+	}
+
+	ids := make(map[string]bool, len(merged.Rules))
+	for _, rule := range merged.Rules {
+		ids[rule.ID] = true
+	}
+	for _, rule := range merged.Rules {
+		if slices.Equal(cfg.Sources[rule.ID], []string{defaultLayer}) {
+			continue
+		}
+		where := fmt.Sprintf("rule %s (%s)", rule.ID, strings.Join(slices.Compact(slices.Clone(cfg.Sources[rule.ID])), ", "))
+
+		patterns := []string{rule.Regex, rule.Path}
+		for _, allowlist := range rule.Allowlists {
+			patterns = append(patterns, allowlist.Regexes...)
+			patterns = append(patterns, allowlist.Paths...)
+		}
+		for _, err := range patternErrors(patterns) {
+			errs = append(errs, fmt.Sprintf("%s: %v", where, err))
+		}
+		for _, required := range rule.Required {
+			if !ids[required.ID] {
+				errs = append(errs, fmt.Sprintf("%s: required rule %q does not exist", where, required.ID))
+			}
+		}
+
+		if rule.Regex != "" && len(rule.Keywords) == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: no keywords, so the regex runs on every fragment", where))
+		}
+		if rule.Entropy > 0 && rule.Entropy < lowEntropy {
+			warnings = append(warnings, fmt.Sprintf("%s: entropy %.2g is low and lets most strings through", where, rule.Entropy))
+		}
+	}
+	return errs, warnings
+}
+
+// patternErrors compiles every pattern and returns the errors.
+func patternErrors(patterns []string) []error {
+	var errs []error
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("invalid pattern: %w", err))
+		}
+	}
+	return errs
+}
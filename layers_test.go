@@ -0,0 +1,287 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zricethezav/gitleaks/v8/detect"
+)
+
+func writeLayer(t *testing.T, dir, name, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadGitleaksConfigLayers(t *testing.T) {
+	dir := t.TempDir()
+	org := writeLayer(t, dir, "org.toml", `
+title = "org"
+
+[[rules]]
+id = "acme-token"
+description = "Acme token"
+regex = '''acme_[a-z0-9]{16}'''
+keywords = ["acme_"]
+[[rules.allowlists]]
+regexes = ['''acme_0{16}''']
+
+[[rules]]
+id = "legacy-token"
+regex = '''legacy_[a-z0-9]{16}'''
+keywords = ["legacy_"]
+
+[[rules]]
+id = "corp-key"
+regex = '''corpkey_[a-z0-9]{16}'''
+keywords = ["corpkey_"]
+`)
+	team := writeLayer(t, dir, "team.toml", `
+[extend]
+disabledRules = ["legacy-token", "never-defined"]
+
+[[rules]]
+id = "acme-token"
+keywords = ["acme-"]
+[[rules.allowlists]]
+regexes = ['''acme_test[a-z0-9]{12}''']
+
+[[rules]]
+id = "team-token"
+regex = '''team_[a-z0-9]{16}'''
+keywords = ["team_"]
+`)
+	project := writeLayer(t, dir, "project.toml", `
+title = "project"
+
+[[rules]]
+id = "acme-token"
+description = "Acme API token"
+`)
+
+	cfg, err := loadGitleaksConfig([]string{org, team, project}, filepath.Join(dir, "missing-overlay.toml"))
+	if err != nil {
+		t.Fatalf("loadGitleaksConfig: %v", err)
+	}
+
+	if want := []string{org, team, project}; !slices.Equal(cfg.Layers, want) {
+		t.Errorf("layers = %v, want %v", cfg.Layers, want)
+	}
+	var ids []string
+	for _, rule := range cfg.Config.GetOrderedRules() {
+		ids = append(ids, rule.RuleID)
+	}
+	if want := []string{"acme-token", "corp-key", "team-token"}; !slices.Equal(ids, want) {
+		t.Errorf("rules = %v, want %v", ids, want)
+	}
+
+	acme := cfg.Config.Rules["acme-token"]
+	if acme.Description != "Acme API token" {
+		t.Errorf("description = %q, want the last layer's", acme.Description)
+	}
+	if !slices.Equal(acme.Keywords, []string{"acme_", "acme-"}) {
+		t.Errorf("keywords = %v, want both layers'", acme.Keywords)
+	}
+	if len(acme.Allowlists) != 2 {
+		t.Errorf("allowlists = %d, want both layers'", len(acme.Allowlists))
+	}
+	if want := []string{org, team, project}; !slices.Equal(cfg.Sources["acme-token"], want) {
+		t.Errorf("sources = %v, want %v", cfg.Sources["acme-token"], want)
+	}
+	if _, ok := cfg.Sources["legacy-token"]; ok {
+		t.Error("disabled rule still has sources")
+	}
+	if len(cfg.Warnings) != 1 || !strings.Contains(cfg.Warnings[0], "never-defined") {
+		t.Errorf("warnings = %v, want one about never-defined", cfg.Warnings)
+	}
+	if cfg.Config.Title != "project" {
+		t.Errorf("title = %q", cfg.Config.Title)
+	}
+
+	detector := detect.NewDetector(cfg.Config)
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"acme_a1b2c3d4e5f6a7b8", "acme-token"},
+		{"acme_0000000000000000", ""},   // org allowlist
+		{"acme_testa1b2c3d4e5f6", ""},   // team allowlist
+		{"legacy_a1b2c3d4e5f6a7b8", ""}, // disabled by team
+		{"team_a1b2c3d4e5f6a7b8", "team-token"},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, f := range detector.DetectString(tt.text) {
+			got = append(got, f.RuleID)
+		}
+		if tt.want == "" && len(got) > 0 || tt.want != "" && !slices.Equal(got, []string{tt.want}) {
+			t.Errorf("DetectString(%q) = %v, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLoadGitleaksConfigDefaultAndOverlay(t *testing.T) {
+	dir := t.TempDir()
+	project := writeLayer(t, dir, "project.toml", `
+[extend]
+useDefault = true
+disabledRules = ["generic-api-key"]
+`)
+	overlay := writeLayer(t, dir, "overlay.toml", `
+[[rules]]
+id = "github-pat"
+[[rules.allowlists]]
+regexTarget = "secret"
+regexes = ['''^ghp_0+$''']
+`)
+
+	cfg, err := loadGitleaksConfig([]string{project}, overlay)
+	if err != nil {
+		t.Fatalf("loadGitleaksConfig: %v", err)
+	}
+	if want := []string{defaultLayer, project, overlay}; !slices.Equal(cfg.Layers, want) {
+		t.Errorf("layers = %v, want %v", cfg.Layers, want)
+	}
+	if _, ok := cfg.Config.Rules["generic-api-key"]; ok {
+		t.Error("generic-api-key was not disabled")
+	}
+	if want := []string{defaultLayer, overlay}; !slices.Equal(cfg.Sources["github-pat"], want) {
+		t.Errorf("github-pat sources = %v, want %v", cfg.Sources["github-pat"], want)
+	}
+
+	// without useDefault the default rules are left out
+	standalone := writeLayer(t, dir, "standalone.toml", `
+[[rules]]
+id = "acme-token"
+regex = '''acme_[a-z0-9]{16}'''
+`)
+	only, err := loadGitleaksConfig([]string{standalone}, "")
+	if err != nil {
+		t.Fatalf("loadGitleaksConfig: %v", err)
+	}
+	if slices.Contains(only.Layers, defaultLayer) {
+		t.Errorf("layers = %v, want no default layer", only.Layers)
+	}
+
+	// the hash follows the contents of the files
+	before := cfg.Hash
+	writeLayer(t, dir, "overlay.toml", "\n")
+	after, err := loadGitleaksConfig([]string{project}, overlay)
+	if err != nil {
+		t.Fatalf("loadGitleaksConfig: %v", err)
+	}
+	if after.Hash == before {
+		t.Error("hash did not change with the overlay")
+	}
+}
+
+func TestLoadGitleaksConfigExtendPath(t *testing.T) {
+	dir := t.TempDir()
+	base := writeLayer(t, dir, "base.toml", `
+[[rules]]
+id = "acme-token"
+regex = '''acme_[a-z0-9]{16}'''
+keywords = ["acme_"]
+
+[[rules]]
+id = "legacy-token"
+regex = '''legacy_[a-z0-9]{16}'''
+keywords = ["legacy_"]
+`)
+	team := writeLayer(t, dir, "team.toml", `
+[extend]
+path = "`+base+`"
+
+[[rules]]
+id = "team-token"
+regex = '''team_[a-z0-9]{16}'''
+keywords = ["team_"]
+`)
+	project := writeLayer(t, dir, "project.toml", `
+[extend]
+path = "`+team+`"
+disabledRules = ["legacy-token"]
+
+[[rules]]
+id = "acme-token"
+description = "Acme API token"
+`)
+
+	cfg, err := loadGitleaksConfig([]string{project}, "")
+	if err != nil {
+		t.Fatalf("loadGitleaksConfig: %v", err)
+	}
+	if want := []string{base, team, project}; !slices.Equal(cfg.Layers, want) {
+		t.Errorf("layers = %v, want %v", cfg.Layers, want)
+	}
+	if _, ok := cfg.Config.Rules["legacy-token"]; ok {
+		t.Error("legacy-token was not disabled")
+	}
+	if _, ok := cfg.Config.Rules["team-token"]; !ok {
+		t.Error("team-token from the extended layer is missing")
+	}
+	if want := []string{base, project}; !slices.Equal(cfg.Sources["acme-token"], want) {
+		t.Errorf("acme-token sources = %v, want %v", cfg.Sources["acme-token"], want)
+	}
+	if got := cfg.Config.Rules["acme-token"].Description; got != "Acme API token" {
+		t.Errorf("description = %q, want the extending layer's", got)
+	}
+
+	// an extended file changing changes the hash
+	before := cfg.Hash
+	writeLayer(t, dir, "base.toml", `
+[[rules]]
+id = "acme-token"
+regex = '''acme_[a-z0-9]{20}'''
+`)
+	after, err := loadGitleaksConfig([]string{project}, "")
+	if err != nil {
+		t.Fatalf("loadGitleaksConfig: %v", err)
+	}
+	if after.Hash == before {
+		t.Error("hash did not change with the extended file")
+	}
+
+	// a cycle runs into the depth limit
+	loop := filepath.Join(dir, "loop.toml")
+	writeLayer(t, dir, "loop.toml", "[extend]\npath = \""+loop+"\"\n")
+	if _, err := loadGitleaksConfig([]string{loop}, ""); err == nil || !strings.Contains(err.Error(), "levels deep") {
+		t.Errorf("loadGitleaksConfig with a cycle: err = %v, want a depth error", err)
+	}
+}
+
+func TestLoadGitleaksConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		"invalid regex": `
+[[rules]]
+id = "bad"
+regex = '''(unclosed'''
+`,
+		"extend url": `
+[extend]
+url = "https://example.com/gitleaks.toml"
+`,
+		"extend missing path": `
+[extend]
+path = "no-such-base.toml"
+`,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := writeLayer(t, dir, strings.ReplaceAll(name, " ", "-")+".toml", data)
+			if _, err := loadGitleaksConfig([]string{path}, ""); err == nil {
+				t.Error("loadGitleaksConfig succeeded")
+			}
+		})
+	}
+	if _, err := loadGitleaksConfig([]string{filepath.Join(dir, "missing.toml")}, ""); err == nil {
+		t.Error("loadGitleaksConfig succeeded with a missing layer")
+	}
+}
@@ -10,22 +10,70 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
+// commands are the subcommands run in place of the proxy.
+var commands = map[string]func(args []string) error{
+	"config":   runConfig,
+	"scan":     runScan,
+	"replay":   runReplay,
+	"report":   runReport,
+	"feedback": runFeedback,
+	"corpus":   runCorpus,
+}
+
+// commandLogger logs to stderr, so logs don't mix with a command's report.
+// Only warnings and errors are shown unless debug is set.
+func commandLogger(debug bool) *slog.Logger {
+	logLevel := slog.LevelWarn
+	if debug {
+		logLevel = slog.LevelDebug
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level:       logLevel,
+		ReplaceAttr: replaceLevel,
+	}))
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "claude-gitleaks %s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	if err := run(); err != nil {
 		slog.Error("application error", "error", err)
 		os.Exit(1)
 	}
 }
 
+// stringList is a flag that can be given more than once.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func run() (err error) {
 	// Parse command line flags
 	rejectOnLeak := flag.Bool("reject", false, "reject requests with detected API key leaks instead of redacting")
-	configPath := flag.String("config", "", "path to gitleaks config file (uses default config if not specified)")
+	structured := flag.Bool("structured", false, "parse request bodies as Anthropic messages and scan each content block (enables tool-aware detectors)")
+	var configPaths stringList
+	flag.Var(&configPaths, "config", "path to gitleaks config file, repeat to layer configs in order (uses default config if not specified)")
+	policyPath := flag.String("policy", "", "path to proxy policy file (uses default policy if not specified)")
 	port := flag.Int("port", 8000, "port to run the proxy on")
 	host := flag.String("host", "", "host to bind to (empty = all interfaces)")
 	debug := flag.Bool("debug", false, "enable debug logging")
@@ -37,7 +85,8 @@ func run() (err error) {
 		logLevel = slog.LevelDebug
 	}
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: logLevel,
+		Level:       logLevel,
+		ReplaceAttr: replaceLevel,
 	}))
 	slog.SetDefault(logger)
 
@@ -61,10 +110,40 @@ func run() (err error) {
 		upstreamURL = "https://api.anthropic.com"
 	}
 
-	proxy, err := NewProxy(upstreamURL, *rejectOnLeak, *configPath, logger)
+	policy, err := loadPolicy(*policyPath)
+	if err != nil {
+		return fmt.Errorf("load policy from %s: %w", *policyPath, err)
+	}
+
+	proxy, err := NewProxy(upstreamURL, *rejectOnLeak, *structured, configPaths, policy, logger)
 	if err != nil {
 		return fmt.Errorf("failed to create proxy: %w", err)
 	}
+	// runs after the server has shut down, so no scan is still in flight
+	defer proxy.Close()
+
+	// Reload the policy, the gitleaks configs, the known-secrets and
+	// honeytoken registries and the ignore files on SIGHUP, and whenever
+	// one of their files changes
+	reload := func(reason string) {
+		slog.Info("reloading", "reason", reason)
+		if err := proxy.Reload(*policyPath); err != nil {
+			slog.Error("reload failed, keeping previous state", "error", err)
+		}
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			reload("SIGHUP")
+		}
+	}()
+
+	watched := func() []string { return proxy.WatchedFiles(*policyPath) }
+	if err := watchFiles(ctx, watched, func() { reload("file changed") }); err != nil {
+		slog.Warn("not watching config files, reload with SIGHUP", "error", err)
+	}
 
 	// Wrap proxy with OTEL HTTP instrumentation
 	handler := otelhttp.NewHandler(proxy, "claude-gitleaks")
@@ -74,8 +153,8 @@ func run() (err error) {
 	srv := &http.Server{
 		Addr:         proxyAddr,
 		BaseContext:  func(net.Listener) context.Context { return ctx },
-		ReadTimeout:  time.Second * 30,
-		WriteTimeout: time.Second * 90,
+		ReadTimeout:  serverReadTimeout,
+		WriteTimeout: serverWriteTimeout,
 		Handler:      handler,
 	}
 
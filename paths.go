@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// pathRule is a compiled PathPolicy pattern.
+type pathRule struct {
+	pattern string
+	re      *regexp.Regexp
+	action  string
+}
+
+// actionStrictness orders path actions from most to least permissive, with
+// the proxy default in the middle, so the strictest of several paths wins.
+var actionStrictness = map[string]int{
+	actionAllow:  0,
+	actionLog:    1,
+	"":           2,
+	actionRedact: 3,
+	actionReject: 4,
+}
+
+// fileReaders are the commands a Bash call may run for a path allow rule to
+// apply to its output. They print the files they are given and nothing else.
+var fileReaders = []string{"cat", "bat", "head", "tail", "nl", "grep", "egrep", "fgrep", "diff", "wc", "strings"}
+
+// commandPathLike picks shell words that look like files: anything with a
+// slash, dotfiles, ~ and $HOME paths, and names with an extension.
+var commandPathLike = regexp.MustCompile(`/|^[.~]|^\$\{?HOME|\.[A-Za-z0-9]+$`)
+
+func newPathRules(policies []PathPolicy) ([]pathRule, error) {
+	var rules []pathRule
+	for _, policy := range policies {
+		for _, pattern := range policy.Patterns {
+			re, err := compileGlob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("compile path pattern %q: %w", pattern, err)
+			}
+			rules = append(rules, pathRule{pattern: pattern, re: re, action: policy.Action})
+		}
+	}
+	return rules, nil
+}
+
+// compileGlob turns a path pattern into a regexp. See PathPolicy for the
+// syntax.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	pattern = strings.ReplaceAll(expandHome(pattern), `\`, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !strings.HasPrefix(pattern, "/") {
+		b.WriteString("(?:.*/)?")
+	}
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			if i+1 < len(runes) && runes[i+1] == '*' {
+				i++
+				if i+1 < len(runes) && runes[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		}
+	}
+	if strings.HasSuffix(pattern, "/") {
+		b.WriteString(".*")
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// expandHome replaces a leading ~ or $HOME with the home directory.
+func expandHome(p string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	for _, prefix := range []string{"~", "$HOME", "${HOME}"} {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return home + p[len(prefix):]
+		}
+	}
+	return p
+}
+
+// sourcePaths returns the files behind a tool call: the path in the input of
+// Read, Edit, Grep and the like, or the file arguments of a Bash command.
+func sourcePaths(loc Location) []string {
+	if loc.ToolName == "Bash" {
+		return commandPaths(loc.Target)
+	}
+	if loc.Path != "" {
+		return []string{loc.Path}
+	}
+	return nil
+}
+
+// commandPaths returns the arguments of a shell command that look like files,
+// e.g. "~/.aws/credentials" in `cat ~/.aws/credentials | head`. It does not
+// follow variables, subshells or cd.
+func commandPaths(command string) []string {
+	var paths []string
+	for _, word := range shellWords(command) {
+		if strings.HasPrefix(word, "-") {
+			// --env-file=.env
+			_, value, ok := strings.Cut(word, "=")
+			if !ok {
+				continue
+			}
+			word = value
+		} else if strings.Contains(word, "=") {
+			// an environment assignment
+			continue
+		}
+		if word == "" || strings.Contains(word, "://") || !commandPathLike.MatchString(word) {
+			continue
+		}
+		paths = append(paths, word)
+	}
+	return paths
+}
+
+// shellWords splits a command line into words, honoring quotes and
+// backslashes and treating pipes, redirections and separators as breaks.
+func shellWords(command string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	flush := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	var quote rune
+	escaped := false
+	for _, r := range command {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case strings.ContainsRune(" \t\n;|&<>()", r):
+			flush()
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	flush()
+	return words
+}
+
+// readsOnlyFiles reports whether a command runs one file reader and nothing
+// else: no separators, pipes, background jobs, redirections or command
+// substitutions, even quoted ones.
+func readsOnlyFiles(command string) bool {
+	if strings.ContainsAny(command, ";|&<>`\n") || strings.Contains(command, "$(") {
+		return false
+	}
+	words := shellWords(command)
+	return len(words) > 0 && slices.Contains(fileReaders, path.Base(words[0]))
+}
+
+// pathAction returns the action of the first rule matching p, and the
+// pattern that matched.
+func pathAction(rules []pathRule, p string) (string, string) {
+	p = path.Clean(strings.ReplaceAll(expandHome(p), `\`, "/"))
+	for _, rule := range rules {
+		// directories given to Grep or Glob match patterns ending in /
+		if rule.re.MatchString(p) || rule.re.MatchString(p+"/") {
+			return rule.action, rule.pattern
+		}
+	}
+	return "", ""
+}
+
+// applyPathPolicy sets the action of the findings from loc according to the
+// files it read. When a command read several files, the strictest action
+// wins, and allow only applies when every file is allowed and the command
+// does nothing but read them: `cat .env.example; env` must not pass the
+// environment through. Registered secrets and honeytokens are never allowed
+// through, and honeytokens keep their own action.
+func (s *Scanner) applyPathPolicy(loc Location, findings []Finding) []Finding {
+	if len(s.paths) == 0 || len(findings) == 0 {
+		return findings
+	}
+	paths := sourcePaths(loc)
+	if len(paths) == 0 {
+		return findings
+	}
+
+	action, pattern := pathAction(s.paths, paths[0])
+	for _, p := range paths[1:] {
+		if a, pat := pathAction(s.paths, p); actionStrictness[a] > actionStrictness[action] {
+			action, pattern = a, pat
+		}
+	}
+	if action == "" {
+		return findings
+	}
+	if action == actionAllow && loc.ToolName == "Bash" && !readsOnlyFiles(loc.Target) {
+		s.log.Debug("path allow ignored, command does more than read files", "paths", paths, "pattern", pattern)
+		return findings
+	}
+	s.log.Debug("path policy matched", "paths", paths, "pattern", pattern, "action", action)
+
+	kept := findings[:0]
+	for _, f := range findings {
+		switch {
+		case strings.HasPrefix(f.RuleID, honeytokenRuleID+":"):
+		case action == actionAllow && strings.HasPrefix(f.RuleID, knownSecretRuleID+":"):
+		case action == actionAllow:
+			s.log.Info("finding allowed by path", "rule", f.RuleID, "fingerprint", f.Fingerprint, "pattern", pattern)
+			continue
+		default:
+			f.Action = action
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestCommandPaths(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"cat ~/.aws/credentials | head", []string{"~/.aws/credentials"}},
+		{`grep -n "api key" config/app.yaml src/`, []string{"config/app.yaml", "src/"}},
+		{"docker run --env-file=.env app", []string{".env"}},
+		{"FOO=bar cat 'my file.txt'", []string{"my file.txt"}},
+		{"cat .env.example; env", []string{".env.example"}},
+		{"curl https://example.com/a.json", nil},
+		{"env", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			if got := commandPaths(tt.command); !slices.Equal(got, tt.want) {
+				t.Errorf("commandPaths(%q) = %q, want %q", tt.command, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathAction(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	rules, err := newPathRules([]PathPolicy{
+		{Patterns: []string{"testdata/", "**/*.example"}, Action: actionAllow},
+		{Patterns: []string{"~/.aws/", ".env*"}, Action: actionReject},
+		{Patterns: []string{"/etc/*.conf"}, Action: actionLog},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"testdata/pii/valid.txt", actionAllow},
+		{"/repo/pkg/testdata", actionAllow},
+		{"deploy/.env.example", actionAllow},
+		{"~/.aws/credentials", actionReject},
+		{home + "/.aws/config", actionReject},
+		{"$HOME/.aws/config", actionReject},
+		{"app/.env.local", actionReject},
+		{"/etc/app.conf", actionLog},
+		{"/etc/app/sub.conf", ""},
+		{"src/main.go", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got, _ := pathAction(rules, tt.path); got != tt.want {
+				t.Errorf("pathAction(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyPathPolicy(t *testing.T) {
+	rules, err := newPathRules([]PathPolicy{
+		{Patterns: []string{"*.example", "testdata/"}, Action: actionAllow},
+		{Patterns: []string{".env"}, Action: actionReject},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Scanner{paths: rules, log: slog.New(slog.DiscardHandler)}
+
+	tests := []struct {
+		name string
+		loc  Location
+		// want is the action of the finding, or "dropped" if it was allowed
+		want string
+	}{
+		{"read allowed file", Location{ToolName: "Read", Path: "conf/.env.example"}, "dropped"},
+		{"cat allowed file", Location{ToolName: "Bash", Target: "cat conf/.env.example"}, "dropped"},
+		{"head allowed files", Location{ToolName: "Bash", Target: "head -n 5 a.example testdata/b.txt"}, "dropped"},
+		{"separator", Location{ToolName: "Bash", Target: "cat .env.example; env"}, ""},
+		{"and", Location{ToolName: "Bash", Target: "cat .env.example && printenv"}, ""},
+		{"pipe", Location{ToolName: "Bash", Target: "cat .env.example | sh"}, ""},
+		{"substitution", Location{ToolName: "Bash", Target: "cat .env.example $(env > /dev/stderr)"}, ""},
+		{"not a reader", Location{ToolName: "Bash", Target: "sh -c env .env.example"}, ""},
+		{"one file rejected", Location{ToolName: "Bash", Target: "cat a.example .env"}, actionReject},
+		{"reject with pipe", Location{ToolName: "Bash", Target: "cat .env | head"}, actionReject},
+		{"no matching path", Location{ToolName: "Read", Path: "src/main.go"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := s.applyPathPolicy(tt.loc, []Finding{{RuleID: "generic-api-key", Secret: "s3cr3t"}})
+			got := "dropped"
+			if len(findings) > 0 {
+				got = findings[0].Action
+			}
+			if got != tt.want {
+				t.Errorf("action = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// registered secrets are never allowed through
+	known := []Finding{{RuleID: knownSecretRuleID + ":DB_PASSWORD", Secret: "hunter2hunter2"}}
+	if got := s.applyPathPolicy(Location{ToolName: "Read", Path: "a.example"}, known); len(got) != 1 {
+		t.Errorf("known secret was allowed through by path")
+	}
+}
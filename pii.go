@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// piiDetector finds one kind of personal data. Candidates matched by pattern
+// are only reported if valid accepts them, which is where checksums are
+// checked.
+type piiDetector struct {
+	ruleID  string
+	pattern *regexp.Regexp
+	valid   func(text string, start, end int) bool
+}
+
+// nationalIDDetectors are the national ID formats that can be enabled by name
+// in the pii.national_ids policy setting.
+var nationalIDDetectors = map[string]piiDetector{
+	// 123-45-6789; SSNs have no check digit, so the dashes are required and
+	// the area, group and serial ranges the SSA never issues are rejected
+	"us-ssn": {
+		ruleID:  "pii-us-ssn",
+		pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+		valid:   matchValid(validSSN),
+	},
+	// 12345678Z and the X1234567L foreigner (NIE) form, mod 23 check letter
+	"es-dni": {
+		ruleID:  "pii-es-dni",
+		pattern: regexp.MustCompile(`\b[XYZ]?\d{7,8}-?[A-Z]\b`),
+		valid:   matchValid(validDNI),
+	},
+	// 9 digit burgerservicenummer, 11-proof
+	"nl-bsn": {
+		ruleID:  "pii-nl-bsn",
+		pattern: regexp.MustCompile(`\b\d{9}\b`),
+		valid:   matchValid(validBSN),
+	},
+	// 529.982.247-25, two mod 11 check digits
+	"br-cpf": {
+		ruleID:  "pii-br-cpf",
+		pattern: regexp.MustCompile(`\b\d{3}\.?\d{3}\.?\d{3}-?\d{2}\b`),
+		valid:   matchValid(validCPF),
+	},
+	// 11 digit PESEL, weighted mod 10 check digit
+	"pl-pesel": {
+		ruleID:  "pii-pl-pesel",
+		pattern: regexp.MustCompile(`\b\d{11}\b`),
+		valid:   matchValid(validPESEL),
+	},
+	// 12 digit Aadhaar, Verhoeff check digit
+	"in-aadhaar": {
+		ruleID:  "pii-in-aadhaar",
+		pattern: regexp.MustCompile(`\b[2-9]\d{3} ?\d{4} ?\d{4}\b`),
+		valid:   matchValid(validAadhaar),
+	},
+}
+
+var (
+	// 13 to 19 digits, optionally grouped with spaces or dashes
+	cardPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	// country code, check digits and up to 30 alphanumerics, optionally in groups of four
+	ibanPattern  = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`)
+	emailPattern = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}\b`)
+	// +44 20 7946 0958 and (555) 010-0199; numbers without a country code or
+	// area code in parentheses are too easily confused with other numbers
+	phonePattern = regexp.MustCompile(`\+\d{1,3}[ .-]?(?:\(\d{1,4}\)[ .-]?)?\d{1,4}(?:[ .-]?\d{1,4}){1,4}\b|\(\d{3}\) ?\d{3}[ .-]\d{4}\b`)
+)
+
+// newPIIDetectors returns the detectors enabled by policy.
+func newPIIDetectors(policy PIIPolicy) ([]piiDetector, error) {
+	var detectors []piiDetector
+	if policy.CreditCards {
+		detectors = append(detectors, piiDetector{ruleID: "pii-credit-card", pattern: cardPattern, valid: matchValid(validCard)})
+	}
+	if policy.IBANs {
+		detectors = append(detectors, piiDetector{ruleID: "pii-iban", pattern: ibanPattern, valid: matchValid(validIBAN)})
+	}
+	for _, name := range policy.NationalIDs {
+		d, ok := nationalIDDetectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown national ID format %q in pii.national_ids", name)
+		}
+		detectors = append(detectors, d)
+	}
+	if policy.Emails {
+		detectors = append(detectors, piiDetector{ruleID: "pii-email", pattern: emailPattern, valid: validEmail})
+	}
+	if policy.Phones {
+		detectors = append(detectors, piiDetector{ruleID: "pii-phone", pattern: phonePattern, valid: matchValid(validPhone)})
+	}
+	return detectors, nil
+}
+
+// detectPII runs each detector over text.
+func detectPII(detectors []piiDetector, text string) []Finding {
+	var findings []Finding
+	for _, d := range detectors {
+		for _, m := range d.pattern.FindAllStringIndex(text, -1) {
+			if !d.valid(text, m[0], m[1]) {
+				continue
+			}
+			findings = append(findings, Finding{RuleID: d.ruleID, Secret: text[m[0]:m[1]], Confidence: 1})
+		}
+	}
+	return findings
+}
+
+// matchValid adapts a validator that only needs the matched text.
+func matchValid(valid func(string) bool) func(string, int, int) bool {
+	return func(text string, start, end int) bool {
+		return valid(text[start:end])
+	}
+}
+
+// digitsOf returns the decimal digits of s, dropping separators.
+func digitsOf(s string) []int {
+	digits := make([]int, 0, len(s))
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+	return digits
+}
+
+// allSame reports whether every digit is the same, as in 0000000000 or
+// 11111111111, which pass several checksums but are never issued.
+func allSame(digits []int) bool {
+	for _, d := range digits[1:] {
+		if d != digits[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// validCard checks the length, issuer prefix and Luhn checksum of a payment
+// card number.
+func validCard(s string) bool {
+	digits := digitsOf(s)
+	if len(digits) < 13 || len(digits) > 19 || allSame(digits) {
+		return false
+	}
+	// a mix of separators is a list of numbers, not a card number
+	if strings.Contains(s, " ") && strings.Contains(s, "-") {
+		return false
+	}
+
+	prefix := 0
+	for _, d := range digits[:4] {
+		prefix = prefix*10 + d
+	}
+	switch {
+	case digits[0] == 4: // Visa
+	case prefix >= 5100 && prefix <= 5599, prefix >= 2221 && prefix <= 2720: // Mastercard
+	case prefix/100 == 34, prefix/100 == 37: // American Express
+	case prefix == 6011, prefix/100 == 65, prefix >= 6440 && prefix <= 6499: // Discover
+	case prefix >= 3528 && prefix <= 3589: // JCB
+	case prefix/100 == 36, prefix >= 3000 && prefix <= 3059: // Diners Club
+	case prefix/100 == 62: // UnionPay
+	default:
+		return false
+	}
+
+	return luhn(digits)
+}
+
+func luhn(digits []int) bool {
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// validIBAN checks the ISO 13616 mod 97 checksum of an IBAN.
+func validIBAN(s string) bool {
+	iban := strings.ReplaceAll(s, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+
+	// move the country code and check digits to the end and turn letters
+	// into numbers, A=10 to Z=35
+	var numeric strings.Builder
+	for _, r := range iban[4:] + iban[:4] {
+		if r >= 'A' && r <= 'Z' {
+			numeric.WriteString(fmt.Sprint(int(r-'A') + 10))
+			continue
+		}
+		numeric.WriteRune(r)
+	}
+
+	n, ok := new(big.Int).SetString(numeric.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// exampleDomains are reserved for documentation (RFC 2606, RFC 6761) and
+// show up in code samples rather than in personal data.
+var exampleDomains = []string{"example.com", "example.org", "example.net", ".example", ".test", ".invalid", ".localhost"}
+
+// validEmail skips documentation addresses, git@host SSH remotes and the
+// user:password@host part of URLs, which connection string detection handles.
+func validEmail(text string, start, end int) bool {
+	if start > 0 && strings.ContainsRune(":/", rune(text[start-1])) {
+		return false
+	}
+	local, domain, _ := strings.Cut(strings.ToLower(text[start:end]), "@")
+	if local == "git" {
+		return false
+	}
+	for _, example := range exampleDomains {
+		if domain == strings.TrimPrefix(example, ".") || strings.HasSuffix(domain, example) {
+			return false
+		}
+	}
+	return true
+}
+
+// validPhone checks that a phone number has a plausible number of digits
+// for E.164.
+func validPhone(s string) bool {
+	n := len(digitsOf(s))
+	return n >= 8 && n <= 15
+}
+
+// validSSN rejects SSNs in the ranges that are never issued.
+func validSSN(s string) bool {
+	area, group, serial := s[0:3], s[4:6], s[7:11]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// validDNI checks the mod 23 control letter of a Spanish DNI or NIE.
+func validDNI(s string) bool {
+	s = strings.ReplaceAll(s, "-", "")
+	// NIEs replace the first digit with X, Y or Z
+	s = strings.NewReplacer("X", "0", "Y", "1", "Z", "2").Replace(s[:1]) + s[1:]
+	if len(s) != 9 {
+		return false
+	}
+	n := 0
+	for _, d := range digitsOf(s[:8]) {
+		n = n*10 + d
+	}
+	return "TRWAGMYFPDXBNJZSQVHLCKE"[n%23] == s[8]
+}
+
+// validBSN checks the 11-proof of a Dutch BSN.
+func validBSN(s string) bool {
+	digits := digitsOf(s)
+	if allSame(digits) {
+		return false
+	}
+	sum := -digits[8]
+	for i, d := range digits[:8] {
+		sum += d * (9 - i)
+	}
+	return sum%11 == 0
+}
+
+// validCPF checks both mod 11 check digits of a Brazilian CPF.
+func validCPF(s string) bool {
+	digits := digitsOf(s)
+	if len(digits) != 11 || allSame(digits) {
+		return false
+	}
+	for n := 9; n <= 10; n++ {
+		sum := 0
+		for i, d := range digits[:n] {
+			sum += d * (n + 1 - i)
+		}
+		if check := sum * 10 % 11 % 10; check != digits[n] {
+			return false
+		}
+	}
+	return true
+}
+
+// validPESEL checks the weighted check digit and the encoded birth month of
+// a Polish PESEL.
+func validPESEL(s string) bool {
+	digits := digitsOf(s)
+	if allSame(digits) {
+		return false
+	}
+	// months are offset by 20 per century, from 1800 (80) to 2200 (60)
+	if month := (digits[2]*10 + digits[3]) % 20; month < 1 || month > 12 {
+		return false
+	}
+	weights := []int{1, 3, 7, 9, 1, 3, 7, 9, 1, 3}
+	sum := 0
+	for i, w := range weights {
+		sum += digits[i] * w
+	}
+	return (10-sum%10)%10 == digits[10]
+}
+
+// Verhoeff dihedral group multiplication and permutation tables.
+var (
+	verhoeffD = [10][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+		{2, 3, 4, 0, 1, 7, 8, 9, 5, 6},
+		{3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+		{4, 0, 1, 2, 3, 9, 5, 6, 7, 8},
+		{5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+		{6, 5, 9, 8, 7, 1, 0, 4, 3, 2},
+		{7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+		{8, 7, 6, 5, 9, 3, 2, 1, 0, 4},
+		{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+	verhoeffP = [8][10]int{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+		{5, 8, 0, 3, 7, 9, 6, 1, 4, 2},
+		{8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+		{9, 4, 5, 3, 1, 2, 6, 8, 7, 0},
+		{4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+		{2, 7, 9, 3, 8, 0, 6, 4, 1, 5},
+		{7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+	}
+)
+
+// validAadhaar checks the Verhoeff check digit of an Indian Aadhaar number.
+func validAadhaar(s string) bool {
+	digits := digitsOf(s)
+	if allSame(digits) {
+		return false
+	}
+	c := 0
+	for i := range digits {
+		c = verhoeffD[c][verhoeffP[i%8][digits[len(digits)-1-i]]]
+	}
+	return c == 0
+}
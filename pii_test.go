@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func allPIIDetectors(t *testing.T) []piiDetector {
+	t.Helper()
+	detectors, err := newPIIDetectors(PIIPolicy{
+		CreditCards: true,
+		IBANs:       true,
+		NationalIDs: slices.Sorted(maps.Keys(nationalIDDetectors)),
+		Emails:      true,
+		Phones:      true,
+	})
+	if err != nil {
+		t.Fatalf("newPIIDetectors: %v", err)
+	}
+	return detectors
+}
+
+// readFixture returns the lines of a testdata file, without comments.
+func readFixture(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestDetectPIIValid(t *testing.T) {
+	detectors := allPIIDetectors(t)
+	for _, line := range readFixture(t, "testdata/pii/valid.txt") {
+		ruleID, text, ok := strings.Cut(line, "\t")
+		if !ok {
+			t.Fatalf("malformed fixture line %q", line)
+		}
+		t.Run(text, func(t *testing.T) {
+			var found []string
+			for _, f := range detectPII(detectors, text) {
+				found = append(found, f.RuleID)
+			}
+			if !slices.Contains(found, ruleID) {
+				t.Errorf("detectPII(%q) = %v, want %s", text, found, ruleID)
+			}
+		})
+	}
+}
+
+func TestDetectPIIInvalid(t *testing.T) {
+	detectors := allPIIDetectors(t)
+	for _, text := range readFixture(t, "testdata/pii/invalid.txt") {
+		t.Run(text, func(t *testing.T) {
+			if findings := detectPII(detectors, text); len(findings) > 0 {
+				t.Errorf("detectPII(%q) = %v, want none", text, findings)
+			}
+		})
+	}
+}
+
+func TestNewPIIDetectorsUnknownFormat(t *testing.T) {
+	if _, err := newPIIDetectors(PIIPolicy{NationalIDs: []string{"xx-id"}}); err == nil {
+		t.Error("newPIIDetectors accepted an unknown national ID format")
+	}
+}
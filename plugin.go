@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// wasmPageSize is the size of a WebAssembly memory page, and wasmMaxPages
+// the most pages a 32-bit memory can have.
+const (
+	wasmPageSize = 64 << 10
+	wasmMaxPages = 1 << 16
+)
+
+// pluginSpan is one finding reported by a WebAssembly or external detector,
+// as byte offsets into the text it was given.
+type pluginSpan struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Rule  string `json:"rule"`
+}
+
+// wasmPlugin is a detector compiled to WebAssembly. A plugin module exports:
+//
+//	memory
+//	alloc(size i32) i32            returns a buffer for the input text
+//	scan(ptr i32, len i32) i64     returns (ptr << 32 | len) of a JSON array
+//	                               of {"start", "end", "rule"} spans
+//
+// Every call runs in a fresh instance, so plugins keep no state between
+// calls, and is bounded by the policy's memory and time limits. WASI is
+// available without filesystem, network or environment access.
+type wasmPlugin struct {
+	name     string
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	timeout  time.Duration
+	log      *slog.Logger
+}
+
+// loadWasmPlugins compiles every .wasm file in policy.Dir. The plugins share
+// one runtime, which enforces the memory limit, and which is closed again if
+// any plugin fails to load.
+func loadWasmPlugins(policy PluginPolicy, logger *slog.Logger) (plugins []Inspector, err error) {
+	if policy.Dir == "" {
+		return nil, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(policy.Dir, "*.wasm"))
+	if err != nil {
+		return nil, fmt.Errorf("list plugins: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(policy.MaxMemory/wasmPageSize)).
+		WithCloseOnContextDone(true))
+	defer func() {
+		if err != nil {
+			runtime.Close(ctx)
+		}
+	}()
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		return nil, fmt.Errorf("instantiate WASI: %w", err)
+	}
+
+	log := logger.With("component", "plugins")
+	for _, path := range paths {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read plugin %s: %w", path, err)
+		}
+		compiled, err := runtime.CompileModule(ctx, code)
+		if err != nil {
+			return nil, fmt.Errorf("compile plugin %s: %w", path, err)
+		}
+		for _, export := range []string{"alloc", "scan"} {
+			if _, ok := compiled.ExportedFunctions()[export]; !ok {
+				return nil, fmt.Errorf("plugin %s does not export %s", path, export)
+			}
+		}
+
+		name := "wasm:" + strings.TrimSuffix(filepath.Base(path), ".wasm")
+		log.Info("loaded detector plugin", "inspector", name, "path", path)
+		plugins = append(plugins, &wasmPlugin{
+			name:     name,
+			runtime:  runtime,
+			compiled: compiled,
+			timeout:  policy.Timeout,
+			log:      log,
+		})
+	}
+	return plugins, nil
+}
+
+func (p *wasmPlugin) Name() string { return p.name }
+
+// Close releases the runtime, which the plugins loaded together share.
+// Closing it more than once is harmless.
+func (p *wasmPlugin) Close() error {
+	return p.runtime.Close(context.Background())
+}
+
+// Inspect runs the plugin over the text. A plugin that fails or runs out of
+// time is logged and its findings for this text are skipped: plugins fail
+// open, so a broken plugin cannot take the proxy down with it.
+func (p *wasmPlugin) Inspect(ctx context.Context, in Inspection) []Finding {
+	spans, err := p.scan(ctx, in.Text)
+	if err != nil {
+		p.log.Warn("detector plugin failed", "inspector", p.name, "error", err)
+		span := trace.SpanFromContext(ctx)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "plugin failed")
+		return in.Findings
+	}
+
+	return appendSpans(in.Findings, p.name, in.Text, spans, p.log)
+}
+
+func (p *wasmPlugin) scan(ctx context.Context, text string) ([]pluginSpan, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	// No stdio, filesystem or clock beyond what WASI needs to start
+	mod, err := p.runtime.InstantiateModule(ctx, p.compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize"))
+	if err != nil {
+		return nil, fmt.Errorf("instantiate: %w", err)
+	}
+	defer mod.Close(context.Background())
+
+	results, err := mod.ExportedFunction("alloc").Call(ctx, uint64(len(text)))
+	if err != nil {
+		return nil, fmt.Errorf("alloc: %w", err)
+	}
+	ptr := uint32(results[0])
+	if !mod.Memory().Write(ptr, []byte(text)) {
+		return nil, errors.New("alloc returned a buffer outside memory")
+	}
+
+	results, err = mod.ExportedFunction("scan").Call(ctx, uint64(ptr), uint64(len(text)))
+	if err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+
+	out, ok := readPacked(mod.Memory(), results[0])
+	if !ok {
+		return nil, errors.New("scan returned a result outside memory")
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	var spans []pluginSpan
+	if err := json.Unmarshal(out, &spans); err != nil {
+		return nil, fmt.Errorf("decode result: %w", err)
+	}
+	return spans, nil
+}
+
+// readPacked reads the buffer described by a (ptr << 32 | len) return value.
+func readPacked(mem api.Memory, packed uint64) ([]byte, bool) {
+	ptr, size := uint32(packed>>32), uint32(packed)
+	if size == 0 {
+		return nil, true
+	}
+	return mem.Read(ptr, size)
+}
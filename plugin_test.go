@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testWasmModule assembles a plugin whose scan ignores its input and returns
+// result, which is placed in memory at offset 16. resultLen overrides the
+// length scan reports, to point outside memory.
+func testWasmModule(result string, resultLen int) []byte {
+	uleb := func(v uint64) []byte {
+		var b []byte
+		for {
+			c := byte(v & 0x7f)
+			v >>= 7
+			if v != 0 {
+				c |= 0x80
+			}
+			b = append(b, c)
+			if v == 0 {
+				return b
+			}
+		}
+	}
+	sleb := func(v int64) []byte {
+		var b []byte
+		for {
+			c := byte(v & 0x7f)
+			v >>= 7
+			if v == 0 && c&0x40 == 0 || v == -1 && c&0x40 != 0 {
+				return append(b, c)
+			}
+			b = append(b, c|0x80)
+		}
+	}
+	name := func(s string) []byte { return append(uleb(uint64(len(s))), s...) }
+	section := func(id byte, body ...[]byte) []byte {
+		content := slices.Concat(body...)
+		return slices.Concat([]byte{id}, uleb(uint64(len(content))), content)
+	}
+
+	const offset = 16
+	allocBody := []byte{0x00, 0x41, 0x80, 0x08, 0x0b} // i32.const 1024
+	scanBody := slices.Concat([]byte{0x00, 0x42}, sleb(int64(offset)<<32|int64(resultLen)), []byte{0x0b})
+	return slices.Concat(
+		[]byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00},
+		// (i32) -> i32 and (i32, i32) -> i64
+		section(1, []byte{0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e}),
+		section(3, []byte{0x02, 0x00, 0x01}),
+		section(5, []byte{0x01, 0x00, 0x01}), // one page
+		section(7, []byte{0x03}, name("memory"), []byte{0x02, 0x00}, name("alloc"), []byte{0x00, 0x00}, name("scan"), []byte{0x00, 0x01}),
+		section(10, []byte{0x02}, uleb(uint64(len(allocBody))), allocBody, uleb(uint64(len(scanBody))), scanBody),
+		section(11, []byte{0x01, 0x00, 0x41, offset, 0x0b}, name(result)),
+	)
+}
+
+func loadTestPlugin(t *testing.T, module []byte) Inspector {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "acme.wasm"), module, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	plugins, err := loadWasmPlugins(PluginPolicy{Dir: dir, MaxMemory: wasmPageSize, Timeout: time.Second}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("loadWasmPlugins: %v", err)
+	}
+	if len(plugins) != 1 {
+		t.Fatalf("loaded %d plugins, want 1", len(plugins))
+	}
+	t.Cleanup(func() { plugins[0].(*wasmPlugin).Close() })
+	return plugins[0]
+}
+
+func TestWasmPlugin(t *testing.T) {
+	result := `[{"start":4,"end":10},{"start":0,"end":3,"rule":"acme-id"},{"start":8,"end":99}]`
+	plugin := loadTestPlugin(t, testWasmModule(result, len(result)))
+	if plugin.Name() != "wasm:acme" {
+		t.Errorf("name = %q", plugin.Name())
+	}
+
+	earlier := Finding{RuleID: "gitleaks-rule", Secret: "other"}
+	findings := plugin.Inspect(context.Background(), Inspection{Text: "id1 s3cr3t here", Findings: []Finding{earlier}})
+	want := []Finding{
+		earlier,
+		{RuleID: "acme", Secret: "s3cr3t"},
+		{RuleID: "acme-id", Secret: "id1"},
+	}
+	if !reflect.DeepEqual(findings, want) {
+		t.Errorf("findings = %+v, want %+v", findings, want)
+	}
+}
+
+func TestWasmPluginFailsOpen(t *testing.T) {
+	// scan reports a result that runs past the end of memory
+	plugin := loadTestPlugin(t, testWasmModule(`[{"start":0,"end":6}]`, wasmPageSize))
+	earlier := Finding{RuleID: "gitleaks-rule", Secret: "s3cr3t"}
+	findings := plugin.Inspect(context.Background(), Inspection{Text: "s3cr3t", Findings: []Finding{earlier}})
+	if !reflect.DeepEqual(findings, []Finding{earlier}) {
+		t.Errorf("findings = %+v, want only the earlier stages'", findings)
+	}
+}
+
+func TestLoadWasmPluginsErrors(t *testing.T) {
+	policy := PluginPolicy{MaxMemory: wasmPageSize, Timeout: time.Second}
+	logger := slog.New(slog.DiscardHandler)
+
+	policy.Dir = t.TempDir()
+	if plugins, err := loadWasmPlugins(policy, logger); err != nil || plugins != nil {
+		t.Errorf("empty dir: plugins = %v, err = %v", plugins, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(policy.Dir, "broken.wasm"), []byte("not wasm"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadWasmPlugins(policy, logger); err == nil {
+		t.Error("loadWasmPlugins succeeded with an invalid module")
+	}
+
+	// a module without the plugin exports
+	policy.Dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(policy.Dir, "empty.wasm"), []byte{0x00, 'a', 's', 'm', 0x01, 0x00, 0x00, 0x00}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadWasmPlugins(policy, logger); err == nil {
+		t.Error("loadWasmPlugins succeeded with a module that exports nothing")
+	}
+}
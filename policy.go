@@ -0,0 +1,484 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Actions a policy can take on a finding.
+const (
+	// actionRedact replaces the secret and forwards the request. It is the
+	// default, unless the proxy runs with -reject.
+	actionRedact = "redact"
+	// actionReject refuses the whole request.
+	actionReject = "reject"
+	// actionLog only logs the finding and leaves the text untouched.
+	actionLog = "log"
+	// actionAllow drops the finding altogether. Only path policies use it.
+	actionAllow = "allow"
+)
+
+// Policy holds the proxy-side scanning settings that sit on top of the
+// gitleaks rules. It is loaded from its own TOML file so the gitleaks config
+// stays a plain, portable gitleaks config.
+type Policy struct {
+	Decode       DecodePolicy       `mapstructure:"decode"`
+	ConfigFiles  ConfigFilePolicy   `mapstructure:"config_files"`
+	KnownSecrets KnownSecretsPolicy `mapstructure:"known_secrets"`
+	Honeytokens  HoneytokenPolicy   `mapstructure:"honeytokens"`
+
+	ConnectionStrings ConnectionStringPolicy `mapstructure:"connection_strings"`
+	KeyBlocks         KeyBlockPolicy         `mapstructure:"key_blocks"`
+	JWT               JWTPolicy              `mapstructure:"jwt"`
+	PII               PIIPolicy              `mapstructure:"pii"`
+	Infra             InfraPolicy            `mapstructure:"infra"`
+	Plugins           PluginPolicy           `mapstructure:"plugins"`
+	External          []ExternalPolicy       `mapstructure:"external"`
+	Confidence        ConfidencePolicy       `mapstructure:"confidence"`
+	Risk              RiskPolicy             `mapstructure:"risk"`
+	Ignore            IgnorePolicy           `mapstructure:"ignore"`
+	SelfTest          SelfTestPolicy         `mapstructure:"self_test"`
+	Capture           CapturePolicy          `mapstructure:"capture"`
+	Feedback          FeedbackPolicy         `mapstructure:"feedback"`
+	// Paths are tried in order against the files a tool call read; the
+	// first match decides what happens to the secrets found in its output.
+	Paths []PathPolicy `mapstructure:"paths"`
+	// Tools are tried in order against each tool call; the first match
+	// changes how that call's input and output are scanned.
+	Tools []ToolPolicy `mapstructure:"tools"`
+
+	// Inspectors is the ordered list of detection stages. Later stages see
+	// and may refine the findings of earlier ones. Plugins are named
+	// "wasm:<file name>" and external detectors "exec:<name>"; they run
+	// last unless they are listed.
+	Inspectors []string `mapstructure:"inspectors"`
+
+	// SessionTTL is how long the proxy remembers an idle session's
+	// pseudonyms and risk.
+	SessionTTL time.Duration `mapstructure:"session_ttl"`
+
+	// Actions maps rule IDs to redact, reject or log. A rule ID without an
+	// entry uses the proxy default. Registry rules such as
+	// "known-secret:DB_PASSWORD" also match on the part before the colon.
+	Actions map[string]string `mapstructure:"actions"`
+}
+
+// Action returns the configured action for ruleID, or "" for the default.
+func (p Policy) Action(ruleID string) string {
+	action, _ := lookupRule(p.Actions, ruleID)
+	return action
+}
+
+// lookupRule finds the entry for ruleID in a policy table keyed by rule ID.
+// Registry rules such as "known-secret:DB_PASSWORD" fall back to the part
+// before the colon. Viper lowercases map keys, so rule IDs are matched
+// case-insensitively.
+func lookupRule[V any](table map[string]V, ruleID string) (V, bool) {
+	ruleID = strings.ToLower(ruleID)
+	if v, ok := table[ruleID]; ok {
+		return v, true
+	}
+	if prefix, _, ok := strings.Cut(ruleID, ":"); ok {
+		if v, ok := table[prefix]; ok {
+			return v, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// DecodePolicy controls recursive decoding of encoded payloads such as
+// base64 Kubernetes secrets, hex dumps and URL-encoded query strings.
+type DecodePolicy struct {
+	// MaxDepth is how many layers of encoding are peeled off before giving up.
+	// 0 disables decoding entirely.
+	MaxDepth int `mapstructure:"max_depth"`
+	// MaxSize is the largest encoded segment, in bytes, that will be decoded.
+	MaxSize int `mapstructure:"max_size"`
+}
+
+// ConfigFilePolicy controls redaction of values in structured config files
+// (.env, YAML, JSON, .npmrc) read by tools.
+type ConfigFilePolicy struct {
+	// SensitiveKeys are regexes matched against key names. The values of
+	// matching keys are redacted regardless of their entropy.
+	SensitiveKeys []string `mapstructure:"sensitive_keys"`
+}
+
+// KnownSecretsPolicy lists the sources of the known-secrets registry. Values
+// are held in memory only and reloaded on SIGHUP.
+type KnownSecretsPolicy struct {
+	// Files contain NAME=value, `name: value` or bare value lines.
+	Files []string `mapstructure:"files"`
+	// Env names environment variables whose values are registered.
+	Env []string `mapstructure:"env"`
+	// Command is run without a shell and its output is parsed like Files,
+	// e.g. ["sops", "-d", "--output-type", "dotenv", "secrets.enc.env"].
+	Command []string `mapstructure:"command"`
+	// MinLength skips values too short to redact without collateral damage.
+	MinLength int `mapstructure:"min_length"`
+}
+
+// HoneytokenPolicy lists decoy credentials planted to catch agents browsing
+// where they shouldn't. A match is treated as a security incident rather
+// than a normal finding.
+type HoneytokenPolicy struct {
+	KnownSecretsPolicy `mapstructure:",squash"`
+	// Action is "reject" or "redact".
+	Action string `mapstructure:"action"`
+	// AuditLog is a JSON lines file that every match is appended to.
+	AuditLog string `mapstructure:"audit_log"`
+}
+
+// ConnectionStringPolicy controls extraction of the password or token from
+// DSNs and URLs, so only that component is redacted.
+type ConnectionStringPolicy struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// KeyBlockPolicy controls whole-block redaction of PEM, OpenSSH and PGP
+// private keys and base64 PKCS#12 bundles.
+type KeyBlockPolicy struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// JWTPolicy decides which JWTs are redacted based on their decoded claims.
+// Signatures are not verified; the claims only steer the decision.
+type JWTPolicy struct {
+	Enabled bool `mapstructure:"enabled"`
+	// AllowExpired passes through tokens whose exp claim is in the past,
+	// such as test fixtures. Off by default: an expired token can still be
+	// accepted by a service that does not check exp.
+	AllowExpired bool `mapstructure:"allow_expired"`
+	// AlwaysRedactIssuers are redacted even when expired or otherwise allowed.
+	AlwaysRedactIssuers []string `mapstructure:"always_redact_issuers"`
+	// AllowIssuers and AllowAudiences pass through tokens with a matching
+	// iss or aud claim.
+	AllowIssuers   []string `mapstructure:"allow_issuers"`
+	AllowAudiences []string `mapstructure:"allow_audiences"`
+}
+
+// PIIPolicy enables the personal data detectors. All of them are off by
+// default. Card numbers, IBANs and national IDs are only reported when their
+// checksum is valid.
+type PIIPolicy struct {
+	CreditCards bool `mapstructure:"credit_cards"`
+	IBANs       bool `mapstructure:"ibans"`
+	// NationalIDs lists formats by name: us-ssn, es-dni, nl-bsn, br-cpf,
+	// pl-pesel and in-aadhaar.
+	NationalIDs []string `mapstructure:"national_ids"`
+	Emails      bool     `mapstructure:"emails"`
+	Phones      bool     `mapstructure:"phones"`
+}
+
+// InfraPolicy lists internal infrastructure identifiers that are replaced
+// with per-session pseudonyms such as host-1.internal.example. Nothing is
+// replaced unless at least one list is set.
+type InfraPolicy struct {
+	// DomainSuffixes match internal hostnames, e.g. "corp.internal".
+	DomainSuffixes []string `mapstructure:"domain_suffixes"`
+	// CIDRs match IP addresses in internal ranges, e.g. "10.0.0.0/8".
+	CIDRs []string `mapstructure:"cidrs"`
+	// Identifiers are literal values grouped by kind, e.g.
+	// aws-account = ["123456789012"]. The kind names the pseudonym.
+	Identifiers map[string][]string `mapstructure:"identifiers"`
+}
+
+// PluginPolicy loads sandboxed WebAssembly detector modules. Plugins fail
+// open: a call that fails or times out is logged and adds no findings, and
+// the other inspectors still run.
+type PluginPolicy struct {
+	// Dir is searched for *.wasm files at startup.
+	Dir string `mapstructure:"dir"`
+	// MaxMemory is the most memory, in bytes, one plugin call may use. It is
+	// rounded down to whole 64 KiB pages, and must be at least one page and
+	// at most 4 GiB.
+	MaxMemory int `mapstructure:"max_memory"`
+	// Timeout bounds each plugin call.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// ExternalPolicy registers an executable that is kept running as a detector
+// and spoken to over newline-delimited JSON on stdin and stdout.
+type ExternalPolicy struct {
+	Name    string   `mapstructure:"name"`
+	Command []string `mapstructure:"command"`
+	// Timeout bounds each request; the default is one second.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// ConfidencePolicy controls the false-positive scorer. Findings scoring below
+// their rule's threshold are logged but not redacted, unless a rule, tool or
+// path policy gives them an action.
+type ConfidencePolicy struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Threshold applies to rules without an entry in Thresholds.
+	Threshold  float64            `mapstructure:"threshold"`
+	Thresholds map[string]float64 `mapstructure:"thresholds"`
+}
+
+// ThresholdFor returns the confidence threshold for ruleID.
+func (c ConfidencePolicy) ThresholdFor(ruleID string) float64 {
+	if threshold, ok := lookupRule(c.Thresholds, ruleID); ok {
+		return threshold
+	}
+	return c.Threshold
+}
+
+// IgnorePolicy lists the findings to pass through unredacted.
+type IgnorePolicy struct {
+	// Files hold gitleaks or proxy fingerprints, one per line. Missing files
+	// are skipped; they are reread on SIGHUP.
+	Files []string `mapstructure:"files"`
+	// AllowMarkers passes secrets on tool result lines marked gitleaks:allow.
+	AllowMarkers bool `mapstructure:"allow_markers"`
+	// FingerprintKeyFile holds a 256-bit key, as 64 hex digits, that keys
+	// the secret hash in fingerprints, so they cannot be used to test
+	// guesses of a secret. Changing it invalidates hashed ignore entries.
+	FingerprintKeyFile string `mapstructure:"fingerprint_key_file"`
+}
+
+// SelfTestPolicy controls the rule self-test run whenever the gitleaks config
+// is loaded.
+type SelfTestPolicy struct {
+	// Mode is warn, which logs failing examples, fail, which refuses the
+	// config, or off.
+	Mode string `mapstructure:"mode"`
+	// Examples are extra example files, added to the built-in examples.
+	Examples []string `mapstructure:"examples"`
+}
+
+// CapturePolicy records scanned request bodies, to replay them against other
+// gitleaks configs.
+type CapturePolicy struct {
+	// File is a JSON lines file every scanned request is appended to. Empty
+	// turns capture off.
+	File string `mapstructure:"file"`
+	// KeyFile holds a 256-bit key as 64 hex digits. With a key, bodies are
+	// stored encrypted as received instead of redacted.
+	KeyFile string `mapstructure:"key_file"`
+}
+
+// FeedbackPolicy enables marking findings as false positives through the
+// admin API. The proxy manages both files; the gitleaks configs passed with
+// -config are never written to.
+type FeedbackPolicy struct {
+	// IgnoreFile receives the fingerprints of false positives. It is read
+	// along with ignore.files. Empty turns feedback off.
+	IgnoreFile string `mapstructure:"ignore_file"`
+	// Config is a gitleaks config that receives rule allowlist regexes. It
+	// is loaded as the last layer, if it exists.
+	Config string `mapstructure:"config"`
+	// Token must be sent as a bearer token with feedback and to read the
+	// rule statistics. It is required when feedback is on.
+	Token string `mapstructure:"token"`
+}
+
+// PathPolicy sets the action for secrets read from files matching Patterns.
+// Patterns are globs where * stays within a directory and ** spans any
+// number of them. A pattern not starting with / or ~ matches at any depth,
+// and a trailing / matches everything below a directory.
+type PathPolicy struct {
+	Patterns []string `mapstructure:"patterns"`
+	// Action is allow, which passes the secrets through untouched, redact,
+	// reject or log.
+	Action string `mapstructure:"action"`
+}
+
+// ToolPolicy changes how the calls of one tool are scanned, e.g. stricter
+// handling of Bash commands that print credentials than of a Grep over
+// source code. It covers both the tool_use input and the tool_result.
+type ToolPolicy struct {
+	// Name is the tool name, e.g. Bash or Read.
+	Name string `mapstructure:"name"`
+	// Commands are regexps matched against the call's command, file path,
+	// pattern or URL. Without any, every call of the tool matches.
+	Commands []string `mapstructure:"commands"`
+	// MaxDepth overrides decode.max_depth.
+	MaxDepth *int `mapstructure:"max_depth"`
+	// Inspectors run after the pipeline for this tool only. Plugins and
+	// external detectors listed here do not run for other tools.
+	Inspectors []string `mapstructure:"inspectors"`
+	// Rules, when set, are the only rules reported; SkipRules are never
+	// reported. Registered secrets and honeytokens are always reported.
+	Rules     []string `mapstructure:"rules"`
+	SkipRules []string `mapstructure:"skip_rules"`
+	// Action applies to findings without a per-rule action; Actions
+	// override per rule.
+	Action  string            `mapstructure:"action"`
+	Actions map[string]string `mapstructure:"actions"`
+}
+
+// RiskPolicy adds up the severity of findings, weighted by confidence, per
+// request and per session. Crossing a threshold raises an alert and, with
+// the reject action, rejects the request even if every single finding would
+// only have been redacted or logged.
+type RiskPolicy struct {
+	// RequestThreshold and SessionThreshold are disabled when 0.
+	RequestThreshold float64 `mapstructure:"request_threshold"`
+	SessionThreshold float64 `mapstructure:"session_threshold"`
+	// Action is "reject" or "redact".
+	Action string `mapstructure:"action"`
+	// Severities weights rules; rules without an entry weigh 1.
+	Severities map[string]float64 `mapstructure:"severities"`
+}
+
+// defaultSeverities are merged under the policy's severities; a table in
+// the policy file replaces a viper default as a whole.
+var defaultSeverities = map[string]float64{
+	"private-key-block": 5,
+	"known-secret":      5,
+	"pii-credit-card":   3,
+	"pii-email":         0.5,
+	"pii-phone":         0.5,
+	// pseudonymized, but internal topology next to credentials is a signal
+	"infra-hostname": 0.25,
+	"infra-ip":       0.25,
+}
+
+// Severity returns the weight of ruleID.
+func (r RiskPolicy) Severity(ruleID string) float64 {
+	if severity, ok := lookupRule(r.Severities, ruleID); ok {
+		return severity
+	}
+	return 1
+}
+
+// setPolicyDefaults registers the defaults used when no policy file is given
+// or when the file leaves a setting out.
+func setPolicyDefaults(v *viper.Viper) {
+	v.SetDefault("inspectors", []string{
+		"gitleaks",
+		// these three refine gitleaks findings, so they must come after it
+		"connection-strings",
+		"key-blocks",
+		"jwt",
+		"pii",
+		"decode",
+		"config-files",
+		"honeytokens",
+		"known-secrets",
+		"infra",
+	})
+	// 5 matches the default of the gitleaks CLI --max-decode-depth flag
+	v.SetDefault("decode.max_depth", 5)
+	v.SetDefault("decode.max_size", 1<<20)
+	v.SetDefault("config_files.sensitive_keys", []string{
+		`(?i)passw(?:or)?d`,
+		`(?i)token`,
+		`(?i)secret`,
+		`(?i)dsn`,
+		// auth, _authToken and Authorization, but not author
+		`(?i)auth(?:$|[^o]|orization)`,
+		`(?i)api[_-]?key`,
+		`(?i)credential`,
+	})
+	v.SetDefault("known_secrets.min_length", 6)
+	v.SetDefault("honeytokens.min_length", 6)
+	v.SetDefault("honeytokens.action", "reject")
+	v.SetDefault("connection_strings.enabled", true)
+	v.SetDefault("key_blocks.enabled", true)
+	v.SetDefault("jwt.enabled", true)
+	v.SetDefault("jwt.allow_expired", false)
+	v.SetDefault("session_ttl", 24*time.Hour)
+	v.SetDefault("confidence.enabled", true)
+	v.SetDefault("risk.action", "reject")
+	v.SetDefault("ignore.files", []string{".gitleaksignore"})
+	v.SetDefault("ignore.allow_markers", true)
+	v.SetDefault("self_test.mode", selfTestWarn)
+	v.SetDefault("plugins.max_memory", 64<<20)
+	v.SetDefault("plugins.timeout", 250*time.Millisecond)
+}
+
+// loadPolicy reads the policy file at policyPath.
+// If policyPath is empty, the defaults are returned.
+func loadPolicy(policyPath string) (Policy, error) {
+	v := viper.New()
+	setPolicyDefaults(v)
+
+	if policyPath != "" {
+		v.SetConfigFile(policyPath)
+		v.SetConfigType("toml")
+		if err := v.ReadInConfig(); err != nil {
+			return Policy{}, fmt.Errorf("read policy file: %w", err)
+		}
+	}
+
+	var policy Policy
+	if err := v.Unmarshal(&policy); err != nil {
+		return Policy{}, fmt.Errorf("unmarshal policy: %w", err)
+	}
+	if policy.Risk.Severities == nil {
+		policy.Risk.Severities = make(map[string]float64)
+	}
+	for ruleID, severity := range defaultSeverities {
+		if _, ok := policy.Risk.Severities[ruleID]; !ok {
+			policy.Risk.Severities[ruleID] = severity
+		}
+	}
+
+	switch policy.Honeytokens.Action {
+	case "reject", "redact":
+	default:
+		return Policy{}, fmt.Errorf("honeytokens.action must be reject or redact, got %q", policy.Honeytokens.Action)
+	}
+
+	switch policy.Risk.Action {
+	case "reject", "redact":
+	default:
+		return Policy{}, fmt.Errorf("risk.action must be reject or redact, got %q", policy.Risk.Action)
+	}
+
+	switch policy.SelfTest.Mode {
+	case selfTestWarn, selfTestFail, selfTestOff:
+	default:
+		return Policy{}, fmt.Errorf("self_test.mode must be warn, fail or off, got %q", policy.SelfTest.Mode)
+	}
+
+	for ruleID, action := range policy.Actions {
+		switch action {
+		case actionRedact, actionReject, actionLog:
+		default:
+			return Policy{}, fmt.Errorf("actions.%s must be redact, reject or log, got %q", ruleID, action)
+		}
+	}
+
+	for i, tool := range policy.Tools {
+		if tool.Action != "" && tool.Action != actionRedact && tool.Action != actionReject && tool.Action != actionLog {
+			return Policy{}, fmt.Errorf("tools[%d].action must be redact, reject or log, got %q", i, tool.Action)
+		}
+		for ruleID, action := range tool.Actions {
+			switch action {
+			case actionRedact, actionReject, actionLog:
+			default:
+				return Policy{}, fmt.Errorf("tools[%d].actions.%s must be redact, reject or log, got %q", i, ruleID, action)
+			}
+		}
+	}
+
+	for i, path := range policy.Paths {
+		switch path.Action {
+		case actionAllow, actionRedact, actionReject, actionLog:
+		default:
+			return Policy{}, fmt.Errorf("paths[%d].action must be allow, redact, reject or log, got %q", i, path.Action)
+		}
+	}
+
+	// a limit of 0 pages would make every plugin call fail, and plugins fail open
+	if policy.Plugins.MaxMemory < wasmPageSize || policy.Plugins.MaxMemory > wasmMaxPages*wasmPageSize {
+		return Policy{}, fmt.Errorf("plugins.max_memory must be between %d and %d bytes, got %d", wasmPageSize, wasmMaxPages*wasmPageSize, policy.Plugins.MaxMemory)
+	}
+	if policy.Plugins.Timeout <= 0 {
+		return Policy{}, fmt.Errorf("plugins.timeout must be positive, got %s", policy.Plugins.Timeout)
+	}
+
+	if (policy.Feedback.IgnoreFile != "" || policy.Feedback.Config != "") && policy.Feedback.Token == "" {
+		return Policy{}, errors.New("feedback.token is required when feedback.ignore_file or feedback.config is set")
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPolicyFeedbackToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr bool
+	}{
+		{"off", "", false},
+		{"ignore file without token", "[feedback]\nignore_file = \"feedback.gitleaksignore\"\n", true},
+		{"config without token", "[feedback]\nconfig = \"feedback.toml\"\n", true},
+		{"with token", "[feedback]\nignore_file = \"feedback.gitleaksignore\"\nconfig = \"feedback.toml\"\ntoken = \"change-me\"\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.toml")
+			if err := os.WriteFile(path, []byte(tt.policy), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadPolicy(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadPolicy error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadPolicyPluginLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr bool
+	}{
+		{"defaults", "", false},
+		{"one page", "[plugins]\nmax_memory = 65536\n", false},
+		{"under a page", "[plugins]\nmax_memory = 65535\n", true},
+		{"over 4 GiB", "[plugins]\nmax_memory = 4294967297\n", true},
+		{"zero timeout", "[plugins]\ntimeout = \"0s\"\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "policy.toml")
+			if err := os.WriteFile(path, []byte(tt.policy), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadPolicy(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadPolicy error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
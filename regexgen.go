@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math/rand/v2"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// maxRepeatSpan caps how far past its minimum an unbounded or wide
+// repetition is sampled, to keep generated strings short.
+const maxRepeatSpan = 16
+
+// sampleCharsets are tried in order for each character class: a random
+// string drawn from the plainest characters a class allows reads more like a
+// real token and survives JSON encoding unchanged.
+var sampleCharsets = []string{
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"-_.+/=",
+	"!#$%&()*,:;<>?@[]^{|}~",
+	" \t\n",
+}
+
+// regexSampler generates random strings that a regex is likely to match.
+// Lookarounds are not supported by Go regexps and so never appear; word
+// boundaries and anchors are ignored, so a sample must still be checked
+// against the rule it is for.
+type regexSampler struct {
+	rng *rand.Rand
+}
+
+// Sample returns a random string for pattern.
+func (g regexSampler) Sample(pattern string) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	g.write(&b, re.Simplify())
+	return b.String(), nil
+}
+
+func (g regexSampler) write(b *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if re.Flags&syntax.FoldCase != 0 && g.rng.IntN(4) == 0 {
+				r = unicode.SimpleFold(r)
+			}
+			b.WriteRune(r)
+		}
+	case syntax.OpCharClass:
+		b.WriteRune(g.classRune(re.Rune))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte(sampleCharsets[0][g.rng.IntN(len(sampleCharsets[0]))])
+	case syntax.OpCapture:
+		g.write(b, re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			g.write(b, sub)
+		}
+	case syntax.OpAlternate:
+		g.write(b, re.Sub[g.rng.IntN(len(re.Sub))])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		low, high := re.Min, re.Max
+		switch re.Op {
+		case syntax.OpStar:
+			low, high = 0, -1
+		case syntax.OpPlus:
+			low, high = 1, -1
+		case syntax.OpQuest:
+			low, high = 0, 1
+		}
+		if high < 0 || high-low > maxRepeatSpan {
+			high = low + maxRepeatSpan
+		}
+		for range low + g.rng.IntN(high-low+1) {
+			g.write(b, re.Sub[0])
+		}
+	}
+	// anchors, boundaries and empty matches write nothing
+}
+
+// classRune picks a rune from a character class, given as pairs of inclusive
+// ranges, preferring the charsets in order.
+func (g regexSampler) classRune(ranges []rune) rune {
+	inClass := func(r rune) bool {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			if r >= ranges[i] && r <= ranges[i+1] {
+				return true
+			}
+		}
+		return false
+	}
+	for _, charset := range sampleCharsets {
+		var allowed []rune
+		for _, r := range charset {
+			if inClass(r) {
+				allowed = append(allowed, r)
+			}
+		}
+		if len(allowed) > 0 {
+			return allowed[g.rng.IntN(len(allowed))]
+		}
+	}
+	if len(ranges) == 0 {
+		return 'x'
+	}
+	i := g.rng.IntN(len(ranges)/2) * 2
+	return ranges[i] + g.rng.Int32N(ranges[i+1]-ranges[i]+1)
+}
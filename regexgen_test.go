@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math/rand/v2"
+	"regexp"
+	"testing"
+)
+
+var samplerPatterns = []string{
+	`ghp_[0-9a-zA-Z]{36}`,
+	`(?i)(?:api|secret)[_-]?key\s*[:=]\s*["']?([a-z0-9]{24,40})`,
+	`\b(AKIA|ASIA)[A-Z2-7]{16}\b`,
+	`xox[bp]-[0-9]{10,13}-[a-zA-Z0-9-]*`,
+	`-----BEGIN (RSA |EC )?PRIVATE KEY-----`,
+	`^sk_live_[\w]+$`,
+}
+
+func samples(t *testing.T, seed uint64, n int) []string {
+	t.Helper()
+	sampler := regexSampler{rng: rand.New(rand.NewPCG(seed, seed))}
+	var out []string
+	for range n {
+		for _, pattern := range samplerPatterns {
+			s, err := sampler.Sample(pattern)
+			if err != nil {
+				t.Fatalf("Sample(%s): %v", pattern, err)
+			}
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func TestRegexSamplerDeterministic(t *testing.T) {
+	first, again := samples(t, 42, 5), samples(t, 42, 5)
+	for i := range first {
+		if first[i] != again[i] {
+			t.Fatalf("sample %d = %q, then %q with the same seed", i, first[i], again[i])
+		}
+	}
+	other := samples(t, 43, 5)
+	same := 0
+	for i := range first {
+		if first[i] == other[i] {
+			same++
+		}
+	}
+	// the literal-only pattern can only vary in its optional group
+	if same > len(first)/2 {
+		t.Errorf("%d of %d samples are the same for seeds 42 and 43", same, len(first))
+	}
+}
+
+func TestRegexSamplerMatches(t *testing.T) {
+	for _, pattern := range samplerPatterns {
+		re := regexp.MustCompile(pattern)
+		sampler := regexSampler{rng: rand.New(rand.NewPCG(1, 2))}
+		for range 50 {
+			s, err := sampler.Sample(pattern)
+			if err != nil {
+				t.Fatalf("Sample(%s): %v", pattern, err)
+			}
+			if !re.MatchString(s) {
+				t.Errorf("sample %q does not match %s", s, pattern)
+			}
+		}
+	}
+
+	if _, err := (regexSampler{rng: rand.New(rand.NewPCG(1, 2))}).Sample(`(unclosed`); err == nil {
+		t.Error("Sample accepted an invalid pattern")
+	}
+}
+
+func TestClassRunePrefersPlainCharacters(t *testing.T) {
+	sampler := regexSampler{rng: rand.New(rand.NewPCG(1, 2))}
+	// \S allows almost anything, but a sample should read like a token
+	for range 100 {
+		if r := sampler.classRune([]rune{0x21, 0x10FFFF}); !regexp.MustCompile(`[A-Za-z0-9]`).MatchString(string(r)) {
+			t.Fatalf("classRune picked %q from a class that allows letters", r)
+		}
+	}
+	// a class with none of the charsets still yields a rune from it
+	if r := sampler.classRune([]rune{'é', 'ë'}); r < 'é' || r > 'ë' {
+		t.Errorf("classRune = %q, want one of é-ë", r)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce folds the burst of events a single save produces into one
+// reload.
+const reloadDebounce = 250 * time.Millisecond
+
+// watchFiles calls reload whenever one of the files listed by paths changes,
+// until ctx is done. paths is asked again on every event, so files a reload
+// adds, such as a new ignore file in the policy, are watched from then on.
+// It watches their directories rather than the files themselves, since many
+// editors save by writing a new file and renaming it over the old one. A
+// directory that cannot be watched is logged and skipped.
+func watchFiles(ctx context.Context, paths func() []string, reload func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create file watcher: %w", err)
+	}
+
+	dirs := make(map[string]struct{})
+	watch := func() map[string]struct{} {
+		files := make(map[string]struct{})
+		for _, path := range paths() {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				slog.Warn("not watching file", "path", path, "error", err)
+				continue
+			}
+			files[abs] = struct{}{}
+			dir := filepath.Dir(abs)
+			if _, ok := dirs[dir]; ok {
+				continue
+			}
+			if err := watcher.Add(dir); err != nil {
+				slog.Warn("not watching directory, reload with SIGHUP", "path", dir, "error", err)
+				continue
+			}
+			dirs[dir] = struct{}{}
+		}
+		return files
+	}
+	files := watch()
+
+	go func() {
+		defer watcher.Close()
+		var debounce *time.Timer
+		for {
+			select {
+			case <-ctx.Done():
+				if debounce != nil {
+					debounce.Stop()
+				}
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+				name := filepath.Clean(event.Name)
+				if _, ok := files[name]; !ok {
+					// a reload since the last event may have listed it
+					files = watch()
+					if _, ok := files[name]; !ok {
+						continue
+					}
+				}
+				slog.Debug("watched file changed", "path", event.Name, "op", event.Op.String())
+				if debounce == nil {
+					debounce = time.AfterFunc(reloadDebounce, reload)
+				} else {
+					debounce.Reset(reloadDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				slog.Warn("file watcher error", "error", err)
+			}
+		}
+	}()
+	return nil
+}
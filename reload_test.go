@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchFilesFollowsPaths(t *testing.T) {
+	dir := t.TempDir()
+	policy := writeLayer(t, dir, "policy.toml", "")
+	ignore := filepath.Join(dir, ".gitleaksignore")
+
+	var mu sync.Mutex
+	watched := []string{policy}
+	paths := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(watched)
+	}
+	reloads := make(chan struct{}, 10)
+	if err := watchFiles(t.Context(), paths, func() { reloads <- struct{}{} }); err != nil {
+		t.Fatalf("watchFiles: %v", err)
+	}
+	expect := func(what string, want bool) {
+		t.Helper()
+		select {
+		case <-reloads:
+			if !want {
+				t.Errorf("%s: reloaded", what)
+			}
+		case <-time.After(4 * reloadDebounce):
+			if want {
+				t.Errorf("%s: no reload", what)
+			}
+		}
+	}
+
+	writeLayer(t, dir, "policy.toml", "[ignore]\n")
+	expect("policy changed", true)
+	writeLayer(t, dir, ".gitleaksignore", "github-pat:0123456789abcdef\n")
+	expect("unlisted file changed", false)
+
+	// as if the reload had added an ignore file
+	mu.Lock()
+	watched = append(watched, ignore)
+	mu.Unlock()
+	if err := os.WriteFile(ignore, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	expect("newly listed file changed", true)
+}
+
+func TestProxyWatchedFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := writeLayer(t, dir, "base.toml", "[[rules]]\nid = \"acme-token\"\nregex = '''acme_[a-z0-9]{16}'''\n")
+	project := writeLayer(t, dir, "project.toml", "[extend]\npath = \""+base+"\"\n")
+	known := writeLayer(t, dir, "known.env", "DB_PASSWORD=correct-horse-battery\n")
+	decoys := writeLayer(t, dir, "decoys.env", "DECOY=decoy-token-value\n")
+	ignore := filepath.Join(dir, ".gitleaksignore")
+	policyPath := filepath.Join(dir, "policy.toml")
+
+	policy := defaultTestPolicy(t)
+	policy.KnownSecrets.Files = []string{known}
+	policy.Honeytokens.Files = []string{decoys}
+	policy.Ignore.Files = []string{ignore}
+	p, err := NewProxy("http://localhost", false, false, []string{project}, policy, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("NewProxy: %v", err)
+	}
+	defer p.Close()
+
+	got := p.WatchedFiles(policyPath)
+	for _, want := range []string{policyPath, base, project, known, decoys, ignore} {
+		if !slices.Contains(got, want) {
+			t.Errorf("watched files %v are missing %s", got, want)
+		}
+	}
+	if slices.Contains(got, defaultLayer) {
+		t.Errorf("watched files %v include the built-in config", got)
+	}
+}
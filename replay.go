@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+)
+
+// maxCaptureLine is the longest capture line replay reads. Request bodies
+// with long conversations and images run to tens of megabytes.
+const maxCaptureLine = 256 << 20
+
+// ruleDelta is how often a rule fired on a capture under each config.
+type ruleDelta struct {
+	RuleID    string `json:"rule"`
+	Base      int    `json:"base"`
+	Candidate int    `json:"candidate"`
+	Delta     int    `json:"delta"`
+	// Requests is how many requests the rule fired on a different number of
+	// times.
+	Requests int `json:"requests"`
+}
+
+// replayReport compares two configs over a capture.
+type replayReport struct {
+	// Base describes the baseline: its config layers, or "capture" for the
+	// findings recorded when the capture was made.
+	Base      []string    `json:"base"`
+	Candidate []string    `json:"candidate"`
+	Requests  int         `json:"requests"`
+	Changed   int         `json:"changed"`
+	Skipped   int         `json:"skipped"`
+	Rules     []ruleDelta `json:"rules"`
+}
+
+// runReplay implements `claude-gitleaks replay`, which runs the requests in a
+// capture file through a candidate config and compares the findings per rule
+// with a baseline config, or with what was found when they were captured.
+func runReplay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: claude-gitleaks replay [flags] capture.jsonl")
+		flags.PrintDefaults()
+	}
+	var basePaths, configPaths stringList
+	flags.Var(&configPaths, "config", "path to the candidate gitleaks config file, repeat to layer configs in order (uses default config if not specified)")
+	flags.Var(&basePaths, "base", "path to the baseline gitleaks config file, repeat to layer configs in order (uses the findings recorded in the capture if not specified, which only works for encrypted captures)")
+	policyPath := flags.String("policy", "", "path to proxy policy file (uses default policy if not specified)")
+	keyFile := flags.String("key-file", "", "path to the key of an encrypted capture")
+	format := flags.String("format", "text", "output format: text or json")
+	debug := flags.Bool("debug", false, "enable debug logging")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("replay needs one capture file")
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("-format must be text or json, got %q", *format)
+	}
+
+	var key []byte
+	if *keyFile != "" {
+		var err error
+		if key, err = loadKeyFile(*keyFile, "capture key"); err != nil {
+			return err
+		}
+	}
+	policy, err := loadPolicy(*policyPath)
+	if err != nil {
+		return fmt.Errorf("load policy from %s: %w", *policyPath, err)
+	}
+	logger := commandLogger(*debug)
+
+	candidate, err := NewScanner(configPaths, policy, logger)
+	if err != nil {
+		return fmt.Errorf("create candidate scanner: %w", err)
+	}
+	defer candidate.Close()
+	var base *Scanner
+	if len(basePaths) > 0 {
+		if base, err = NewScanner(basePaths, policy, logger); err != nil {
+			return fmt.Errorf("create baseline scanner: %w", err)
+		}
+		defer base.Close()
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("open capture: %w", err)
+	}
+	defer file.Close()
+
+	report, err := replay(context.Background(), file, key, base, candidate, logger)
+	if err != nil {
+		return err
+	}
+	report.Candidate = candidate.gitleaks.Load().rules.Layers
+	report.Base = []string{"capture"}
+	if base != nil {
+		report.Base = base.gitleaks.Load().rules.Layers
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return writeReplayText(os.Stdout, report)
+}
+
+// replay scans every request in a capture with candidate and, if given,
+// base. Without base, the capture must be encrypted: the counts recorded for
+// a redacted entry can't be compared with a rescan of its redacted body.
+// Entries that cannot be read, such as encrypted ones without the key,
+// are skipped and counted.
+func replay(ctx context.Context, capture io.Reader, key []byte, base, candidate *Scanner, logger *slog.Logger) (replayReport, error) {
+	var report replayReport
+	deltas := make(map[string]*ruleDelta)
+	delta := func(ruleID string) *ruleDelta {
+		d, ok := deltas[ruleID]
+		if !ok {
+			d = &ruleDelta{RuleID: ruleID}
+			deltas[ruleID] = d
+		}
+		return d
+	}
+
+	lines := bufio.NewScanner(capture)
+	lines.Buffer(nil, maxCaptureLine)
+	for n := 1; lines.Scan(); n++ {
+		var entry captureEntry
+		if err := json.Unmarshal(lines.Bytes(), &entry); err != nil {
+			logger.Warn("skipping malformed capture entry", "line", n, "error", err)
+			report.Skipped++
+			continue
+		}
+		body := []byte(entry.Body)
+		if entry.Sealed == "" && base == nil {
+			// the recorded counts are from the body before it was redacted,
+			// so rescanning the redacted body would show every one as lost
+			return replayReport{}, fmt.Errorf("capture line %d is redacted, give -base to compare redacted entries with a baseline config", n)
+		}
+		if entry.Sealed != "" {
+			if key == nil {
+				logger.Warn("skipping encrypted capture entry, no key given", "line", n)
+				report.Skipped++
+				continue
+			}
+			var err error
+			if body, err = unseal(key, entry.Sealed); err != nil {
+				logger.Warn("skipping capture entry", "line", n, "error", err)
+				report.Skipped++
+				continue
+			}
+		}
+		report.Requests++
+
+		baseCounts := entry.Findings
+		if base != nil {
+			baseCounts = countRules(replayScan(ctx, base, body, entry.Structured))
+		}
+		candidateCounts := countRules(replayScan(ctx, candidate, body, entry.Structured))
+
+		changed := false
+		for ruleID := range unionKeys(baseCounts, candidateCounts) {
+			d := delta(ruleID)
+			d.Base += baseCounts[ruleID]
+			d.Candidate += candidateCounts[ruleID]
+			if baseCounts[ruleID] != candidateCounts[ruleID] {
+				d.Requests++
+				changed = true
+			}
+		}
+		if changed {
+			report.Changed++
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return replayReport{}, fmt.Errorf("read capture: %w", err)
+	}
+
+	for _, d := range deltas {
+		d.Delta = d.Candidate - d.Base
+		report.Rules = append(report.Rules, *d)
+	}
+	// biggest changes first, then by rule
+	slices.SortFunc(report.Rules, func(a, b ruleDelta) int {
+		return cmp.Or(cmp.Compare(abs(b.Delta), abs(a.Delta)), cmp.Compare(a.RuleID, b.RuleID))
+	})
+	return report, nil
+}
+
+// replayScan scans a captured body the way the proxy did.
+func replayScan(ctx context.Context, scanner *Scanner, body []byte, structured bool) []Finding {
+	if structured {
+		result, _, _ := scanner.ScanAndReplaceRequestBody(ctx, body, "<REDACTED_KEY>")
+		return result.Findings
+	}
+	return scanner.ScanRequestBody(ctx, body).Findings
+}
+
+func unionKeys(a, b map[string]int) map[string]struct{} {
+	keys := make(map[string]struct{}, len(a)+len(b))
+	for key := range a {
+		keys[key] = struct{}{}
+	}
+	for key := range b {
+		keys[key] = struct{}{}
+	}
+	return keys
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func writeReplayText(w io.Writer, report replayReport) error {
+	fmt.Fprintf(w, "base: %v\n", report.Base)
+	fmt.Fprintf(w, "candidate: %v\n", report.Candidate)
+	fmt.Fprintf(w, "requests: %d replayed, %d changed, %d skipped\n", report.Requests, report.Changed, report.Skipped)
+	if len(report.Rules) == 0 {
+		_, err := fmt.Fprintln(w, "no findings")
+		return err
+	}
+	fmt.Fprintf(w, "\n%-40s %8s %10s %8s %9s\n", "RULE", "BASE", "CANDIDATE", "DELTA", "REQUESTS")
+	for _, d := range report.Rules {
+		if _, err := fmt.Fprintf(w, "%-40s %8d %10d %+8d %9d\n", d.RuleID, d.Base, d.Candidate, d.Delta, d.Requests); err != nil {
+			return err
+		}
+	}
+	return nil
+}
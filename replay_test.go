@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func captureLine(t *testing.T, entry captureEntry) []byte {
+	t.Helper()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(line, '\n')
+}
+
+func TestReplay(t *testing.T) {
+	scanner := newTestScanner(t, defaultTestPolicy(t))
+	logger := slog.New(slog.DiscardHandler)
+	ctx := context.Background()
+	key := bytes.Repeat([]byte{7}, 32)
+	body := []byte(`{"messages":[{"role":"user","content":"token ` + testToken + `"}]}`)
+	recorded := countRules(scanner.ScanRequestBody(ctx, body).Findings)
+	if len(recorded) == 0 {
+		t.Fatal("test body has no findings")
+	}
+
+	sealed, err := seal(key, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := captureLine(t, captureEntry{Findings: recorded, Sealed: sealed})
+	redacted := captureLine(t, captureEntry{Findings: recorded, Body: `{"messages":[{"role":"user","content":"token <REDACTED_KEY>"}]}`})
+
+	t.Run("encrypted against the capture", func(t *testing.T) {
+		report, err := replay(ctx, bytes.NewReader(encrypted), key, nil, scanner, logger)
+		if err != nil {
+			t.Fatalf("replay: %v", err)
+		}
+		if report.Requests != 1 || report.Changed != 0 {
+			t.Errorf("requests = %d, changed = %d, want 1 and 0", report.Requests, report.Changed)
+		}
+	})
+
+	t.Run("redacted without a baseline", func(t *testing.T) {
+		if _, err := replay(ctx, bytes.NewReader(redacted), nil, nil, scanner, logger); err == nil {
+			t.Error("replay succeeded without -base")
+		}
+	})
+
+	t.Run("redacted against the same config", func(t *testing.T) {
+		report, err := replay(ctx, bytes.NewReader(redacted), nil, scanner, scanner, logger)
+		if err != nil {
+			t.Fatalf("replay: %v", err)
+		}
+		if report.Requests != 1 || report.Changed != 0 {
+			t.Errorf("requests = %d, changed = %d, want 1 and 0", report.Requests, report.Changed)
+		}
+		for _, d := range report.Rules {
+			if d.Delta != 0 {
+				t.Errorf("%s: delta = %d, want 0", d.RuleID, d.Delta)
+			}
+		}
+	})
+
+	t.Run("encrypted without a key", func(t *testing.T) {
+		report, err := replay(ctx, bytes.NewReader(encrypted), nil, nil, scanner, logger)
+		if err != nil {
+			t.Fatalf("replay: %v", err)
+		}
+		if report.Requests != 0 || report.Skipped != 1 {
+			t.Errorf("requests = %d, skipped = %d, want 0 and 1", report.Requests, report.Skipped)
+		}
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// runReport implements `claude-gitleaks report rules`, which fetches the rule
+// statistics from a running proxy and prints them.
+func runReport(args []string) error {
+	if len(args) == 0 || args[0] != "rules" {
+		return errors.New("usage: claude-gitleaks report rules [-addr url] [-token token] [-format text|json]")
+	}
+
+	flags := flag.NewFlagSet("report rules", flag.ContinueOnError)
+	addr := flags.String("addr", "http://localhost:8000", "address of the running proxy")
+	token := flags.String("token", os.Getenv("CLAUDE_GITLEAKS_TOKEN"), "feedback token (default $CLAUDE_GITLEAKS_TOKEN)")
+	format := flags.String("format", "text", "output format: text or json")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("-format must be text or json, got %q", *format)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(*addr, "/")+"/debug/rule-stats", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+*token)
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fetch rule stats: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch rule stats: %s", resp.Status)
+	}
+
+	if *format == "json" {
+		_, err := io.Copy(os.Stdout, resp.Body)
+		return err
+	}
+	var report rulesReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return fmt.Errorf("decode rule stats: %w", err)
+	}
+	return writeRulesReport(os.Stdout, report)
+}
+
+func writeRulesReport(w io.Writer, report rulesReport) error {
+	fmt.Fprintf(w, "since %s, %d requests scanned\n", report.Since.Format(time.RFC3339), report.Requests)
+
+	fmt.Fprintf(w, "\nnoisy rules (at least %.0f%% of findings below confidence %.1f):\n", noisyRatio*100, likelyReal)
+	if len(report.Noisy) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, id := range report.Noisy {
+		fmt.Fprintf(w, "  %s\n", id)
+	}
+
+	fmt.Fprintln(w, "\nrules that fired:")
+	if len(report.Rules) == 0 {
+		fmt.Fprintln(w, "  none")
+	}
+	for _, rule := range report.Rules {
+		fmt.Fprintf(w, "  %s: %d findings, %d low confidence, by block %s", rule.RuleID, rule.Count, rule.LowConfidence, formatCounts(rule.ByBlock))
+		if len(rule.ByTool) > 0 {
+			fmt.Fprintf(w, ", by tool %s", formatCounts(rule.ByTool))
+		}
+		fmt.Fprintln(w)
+		if e := rule.Entropy; e != nil {
+			fmt.Fprintf(w, "    entropy min %.2f, median %.2f, max %.2f", e.Min, e.Median, e.Max)
+			if e.Current > 0 {
+				fmt.Fprintf(w, ", threshold %.2g", e.Current)
+			}
+			if e.Suggested > 0 {
+				fmt.Fprintf(w, "; suggest entropy = %.1f (drops %d low confidence, %d likely real)", e.Suggested, e.WouldDrop, e.WouldLose)
+			}
+			fmt.Fprintln(w)
+		}
+		for _, sample := range rule.Samples {
+			fmt.Fprintf(w, "    %s\n", strings.ReplaceAll(sample, "\n", `\n`))
+		}
+	}
+
+	fmt.Fprintf(w, "\nrules that never fired (%d):\n", len(report.Silent))
+	for _, id := range report.Silent {
+		fmt.Fprintf(w, "  %s\n", id)
+	}
+	return nil
+}
+
+// formatCounts prints counts as "a=1 b=2", largest first.
+func formatCounts(counts map[string]int) string {
+	keys := slices.SortedFunc(maps.Keys(counts), func(a, b string) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		return strings.Compare(a, b)
+	})
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s=%d", key, counts[key])
+	}
+	return strings.Join(parts, " ")
+}
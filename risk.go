@@ -0,0 +1,76 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// riskAssessment is the risk of one request and of its session so far.
+type riskAssessment struct {
+	Request float64
+	Session float64
+	// New is how many findings the session had not seen before.
+	New      int
+	Exceeded bool
+}
+
+// findingRisk is a finding's contribution to the risk score: the severity of
+// its rule weighted by its confidence.
+func (r RiskPolicy) findingRisk(f Finding) float64 {
+	confidence := f.Confidence
+	if confidence == 0 {
+		// not scored
+		confidence = 1
+	}
+	return r.Severity(f.RuleID) * confidence
+}
+
+// AssessRisk adds up the risk of the findings in one request and adds the
+// ones the session has not seen before to the session's total. Claude Code
+// resends the whole conversation with every request, so each distinct
+// secret counts once per request and once per session. Log-only findings
+// count too: several weak signals together can still be a credential dump.
+//
+// Only a request that brings new findings can exceed the budget, so a
+// session over its threshold is not locked out by requests that just resend
+// what it has already seen. The findings of a request the reject action
+// turns away are not added to the session, so retrying it is rejected again.
+func (s *session) AssessRisk(policy RiskPolicy, findings []Finding) riskAssessment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var assessment riskAssessment
+	var newRisk float64
+	var newKeys []string
+	counted := make(map[string]struct{}, len(findings))
+	for _, f := range findings {
+		sum := sha256.Sum256([]byte(f.RuleID + "\x00" + f.Secret))
+		key := hex.EncodeToString(sum[:])
+		if _, ok := counted[key]; ok {
+			continue
+		}
+		counted[key] = struct{}{}
+
+		risk := policy.findingRisk(f)
+		assessment.Request += risk
+		if _, ok := s.riskSeen[key]; !ok {
+			newKeys = append(newKeys, key)
+			newRisk += risk
+		}
+	}
+	assessment.New = len(newKeys)
+	assessment.Session = s.risk + newRisk
+
+	assessment.Exceeded = assessment.New > 0 &&
+		(policy.RequestThreshold > 0 && assessment.Request >= policy.RequestThreshold ||
+			policy.SessionThreshold > 0 && assessment.Session >= policy.SessionThreshold)
+	if assessment.Exceeded && policy.Action == "reject" {
+		return assessment
+	}
+
+	for _, key := range newKeys {
+		s.riskSeen[key] = struct{}{}
+	}
+	s.risk = assessment.Session
+	return assessment
+}
@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestAssessRisk(t *testing.T) {
+	a := Finding{RuleID: "aws-access-token", Secret: "AKIA1", Confidence: 1}
+	b := Finding{RuleID: "github-pat", Secret: "ghp_2", Confidence: 1}
+	c := Finding{RuleID: "github-pat", Secret: "ghp_3", Confidence: 0.5}
+
+	type step struct {
+		findings []Finding
+		request  float64
+		session  float64
+		exceeded bool
+	}
+	tests := []struct {
+		name   string
+		action string
+		steps  []step
+	}{
+		{
+			name:   "redact",
+			action: "redact",
+			steps: []step{
+				{findings: []Finding{a, a}, request: 1, session: 1},
+				// the conversation is resent with one more secret
+				{findings: []Finding{a, b}, request: 2, session: 2, exceeded: true},
+				// resent without anything new: over budget but not acted on
+				{findings: []Finding{a, b}, request: 2, session: 2},
+				{findings: nil, session: 2},
+				{findings: []Finding{a, b, c}, request: 2.5, session: 2.5, exceeded: true},
+			},
+		},
+		{
+			name:   "reject",
+			action: "reject",
+			steps: []step{
+				{findings: []Finding{a}, request: 1, session: 1},
+				{findings: []Finding{a, b}, request: 2, session: 2, exceeded: true},
+				// the rejected secret was not added, so a retry is rejected again
+				{findings: []Finding{a, b}, request: 2, session: 2, exceeded: true},
+				// the conversation moved on without it
+				{findings: []Finding{a}, request: 1, session: 1},
+				{findings: nil, session: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := RiskPolicy{SessionThreshold: 2, Action: tt.action}
+			session := newSessionStore(0).Session("s")
+			for i, step := range tt.steps {
+				got := session.AssessRisk(policy, step.findings)
+				if got.Request != step.request || got.Session != step.session || got.Exceeded != step.exceeded {
+					t.Errorf("step %d: got request %v session %v exceeded %v, want %v %v %v",
+						i, got.Request, got.Session, got.Exceeded, step.request, step.session, step.exceeded)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// SARIF 2.1.0, as much of it as code scanning tools need to show findings.
+// See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+}
+
+// writeSARIF writes findings as a SARIF log. Rules are described from the
+// scanner's gitleaks config; the proxy's own detectors are listed by ID.
+// Log-only findings are notes, the rest errors.
+func writeSARIF(w io.Writer, scanner *Scanner, findings []scanFinding) error {
+	rules := scanner.gitleaks.Load().rules.Config.Rules
+	driver := sarifDriver{
+		Name:           "claude-gitleaks",
+		InformationURI: "https://github.com/wheynelau/claude-gitleaks",
+		Rules:          []sarifRule{},
+	}
+	results := make([]sarifResult, 0, len(findings))
+	for _, f := range findings {
+		if !slices.ContainsFunc(driver.Rules, func(r sarifRule) bool { return r.ID == f.RuleID }) {
+			description := f.RuleID
+			if rule, ok := rules[f.RuleID]; ok && rule.Description != "" {
+				description = rule.Description
+			}
+			driver.Rules = append(driver.Rules, sarifRule{ID: f.RuleID, ShortDescription: sarifMessage{Text: description}})
+		}
+
+		level := "error"
+		if f.Action == actionLog {
+			level = "note"
+		}
+		location := sarifLocation{PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactLocation{URI: f.File},
+		}}
+		if f.Line > 0 {
+			location.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line, StartColumn: f.Column}
+		}
+		results = append(results, sarifResult{
+			RuleID:              f.RuleID,
+			Level:               level,
+			Message:             sarifMessage{Text: fmt.Sprintf("%s detected secret %s", f.RuleID, f.Secret)},
+			Locations:           []sarifLocation{location},
+			PartialFingerprints: map[string]string{"claude-gitleaks/v1": f.Fingerprint},
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs:    []sarifRun{{Tool: sarifTool{Driver: driver}, Results: results}},
+	})
+}
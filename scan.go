@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// stdinName is the file name that stands for standard input.
+const stdinName = "-"
+
+// scanFinding is a finding as the scan command reports it. The secret is
+// masked, as it is in the logs.
+type scanFinding struct {
+	File        string   `json:"file"`
+	Line        int      `json:"line,omitempty"`
+	Column      int      `json:"column,omitempty"`
+	RuleID      string   `json:"rule"`
+	Secret      string   `json:"secret"`
+	Fingerprint string   `json:"fingerprint"`
+	Action      string   `json:"action,omitempty"`
+	Confidence  float64  `json:"confidence,omitempty"`
+	Encodings   []string `json:"encodings,omitempty"`
+	Detail      string   `json:"detail,omitempty"`
+	Location    Location `json:"location"`
+}
+
+// runScan implements `claude-gitleaks scan`, which runs the proxy's scanner
+// over files or standard input without a server.
+func runScan(args []string) error {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: claude-gitleaks scan [flags] [file ... | -]")
+		flags.PrintDefaults()
+	}
+	var configPaths stringList
+	flags.Var(&configPaths, "config", "path to gitleaks config file, repeat to layer configs in order (uses default config if not specified)")
+	policyPath := flags.String("policy", "", "path to proxy policy file (uses default policy if not specified)")
+	structured := flags.Bool("structured", false, "parse each input as a saved Anthropic messages request body and scan each content block")
+	format := flags.String("format", "text", "output format: text, json or sarif")
+	debug := flags.Bool("debug", false, "enable debug logging")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	switch *format {
+	case "text", "json", "sarif":
+	default:
+		return fmt.Errorf("-format must be text, json or sarif, got %q", *format)
+	}
+
+	policy, err := loadPolicy(*policyPath)
+	if err != nil {
+		return fmt.Errorf("load policy from %s: %w", *policyPath, err)
+	}
+	scanner, err := NewScanner(configPaths, policy, commandLogger(*debug))
+	if err != nil {
+		return fmt.Errorf("create scanner: %w", err)
+	}
+	defer scanner.Close()
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{stdinName}
+	}
+	ctx := context.Background()
+	findings := []scanFinding{}
+	for _, file := range files {
+		found, err := scanFile(ctx, scanner, file, *structured)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, found...)
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(findings)
+	case "sarif":
+		err = writeSARIF(os.Stdout, scanner, findings)
+	default:
+		err = writeScanText(os.Stdout, findings)
+	}
+	if err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+
+	leaks := 0
+	for _, f := range findings {
+		if f.failsScan() {
+			leaks++
+		}
+	}
+	if leaks > 0 {
+		return fmt.Errorf("%d leaks found", leaks)
+	}
+	return nil
+}
+
+// failsScan reports whether f makes the scan command fail. Log-only findings
+// don't, and neither do infrastructure identifiers the proxy would only
+// replace with pseudonyms.
+func (f scanFinding) failsScan() bool {
+	switch {
+	case f.Action == actionLog:
+		return false
+	case strings.HasPrefix(f.RuleID, infraRulePrefix) && f.Action == actionRedact:
+		return false
+	}
+	return true
+}
+
+// scanFile scans one input. In structured mode the input is a request body
+// and findings carry the content block they came from; otherwise the input is
+// scanned as if the Read tool had returned the file, so tool policies, path
+// policies, path-scoped ignore entries and the config-file inspector apply.
+func scanFile(ctx context.Context, scanner *Scanner, file string, structured bool) ([]scanFinding, error) {
+	var data []byte
+	var err error
+	if file == stdinName {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read input: %w", err)
+	}
+	text := string(data)
+
+	var result ScanResult
+	if structured {
+		result, _, err = scanner.ScanAndReplaceRequestBody(ctx, data, "<REDACTED_KEY>")
+		if err != nil {
+			return nil, fmt.Errorf("scan %s: %w", file, err)
+		}
+	} else {
+		loc := Location{Block: "tool_result", ToolName: "Read"}
+		if file != stdinName {
+			loc.Target, loc.Path = file, file
+		}
+		result = scanner.Scan(ctx, text, loc)
+	}
+
+	findings := make([]scanFinding, 0, len(result.Findings))
+	for _, f := range result.Findings {
+		line, column := position(text, f.Secret)
+		findings = append(findings, scanFinding{
+			File:        file,
+			Line:        line,
+			Column:      column,
+			RuleID:      f.RuleID,
+			Secret:      truncate(f.Secret),
+			Fingerprint: f.Fingerprint,
+			Action:      f.Action,
+			Confidence:  f.Confidence,
+			Encodings:   f.Encodings,
+			Detail:      f.Detail,
+			Location:    f.Location,
+		})
+	}
+	return findings, nil
+}
+
+// position returns the 1-based line and column of the first occurrence of
+// secret in text, or zeros if it does not appear verbatim, e.g. because it
+// is escaped in a JSON body.
+func position(text, secret string) (int, int) {
+	i := strings.Index(text, secret)
+	if i < 0 || secret == "" {
+		return 0, 0
+	}
+	lineStart := strings.LastIndex(text[:i], "\n") + 1
+	return strings.Count(text[:i], "\n") + 1, utf8.RuneCountInString(text[lineStart:i]) + 1
+}
+
+func writeScanText(w io.Writer, findings []scanFinding) error {
+	for _, f := range findings {
+		where := f.File
+		if f.Line > 0 {
+			where = fmt.Sprintf("%s:%d:%d", f.File, f.Line, f.Column)
+		}
+		line := fmt.Sprintf("%s: %s %s", where, f.RuleID, f.Secret)
+		if f.Location.Block != "" {
+			line += " in " + f.Location.Block
+			if f.Location.ToolName != "" {
+				line += " of " + f.Location.ToolName
+			}
+		}
+		if len(f.Encodings) > 0 {
+			line += fmt.Sprintf(" (decoded: %s)", strings.Join(f.Encodings, " -> "))
+		}
+		if f.Detail != "" {
+			line += fmt.Sprintf(" [%s]", f.Detail)
+		}
+		if f.Confidence > 0 {
+			line += fmt.Sprintf(" confidence=%.2f", f.Confidence)
+		}
+		if f.Action == actionLog {
+			line += " (log only)"
+		}
+		line += " fingerprint=" + f.Fingerprint
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d findings\n", len(findings))
+	return err
+}
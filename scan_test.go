@@ -0,0 +1,70 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestScanFileAsRead(t *testing.T) {
+	dir := t.TempDir()
+	env := writeLayer(t, dir, ".env", "DB_PASSWORD=plainpassword\nGITHUB_TOKEN="+testToken+"\n")
+	scanner := newTestScanner(t, defaultTestPolicy(t))
+
+	findings, err := scanFile(t.Context(), scanner, env, false)
+	if err != nil {
+		t.Fatalf("scanFile: %v", err)
+	}
+	var rules []string
+	for _, f := range findings {
+		rules = append(rules, f.RuleID)
+		want := Location{Block: "tool_result", ToolName: "Read", Target: env, Path: env}
+		if f.Location != want {
+			t.Errorf("%s: location = %+v, want %+v", f.RuleID, f.Location, want)
+		}
+	}
+	// the config-file inspector only looks at tool results
+	if !slices.Contains(rules, configFileRuleID) {
+		t.Errorf("rules = %v, want %s for DB_PASSWORD", rules, configFileRuleID)
+	}
+	if !slices.Contains(rules, "github-pat") {
+		t.Errorf("rules = %v, want github-pat", rules)
+	}
+}
+
+func TestScanFileInfraOnly(t *testing.T) {
+	policy := defaultTestPolicy(t)
+	policy.Infra.DomainSuffixes = []string{"corp.internal"}
+	scanner := newTestScanner(t, policy)
+	notes := writeLayer(t, t.TempDir(), "notes.md", "deploy to db1.corp.internal tonight\n")
+
+	findings, err := scanFile(t.Context(), scanner, notes, false)
+	if err != nil {
+		t.Fatalf("scanFile: %v", err)
+	}
+	if len(findings) != 1 || findings[0].RuleID != infraHostRuleID {
+		t.Fatalf("findings = %+v, want one %s", findings, infraHostRuleID)
+	}
+	if findings[0].failsScan() {
+		t.Error("a pseudonym-only finding fails the scan")
+	}
+}
+
+func TestScanFindingFailsScan(t *testing.T) {
+	tests := []struct {
+		finding scanFinding
+		want    bool
+	}{
+		{scanFinding{RuleID: "github-pat"}, true},
+		{scanFinding{RuleID: "github-pat", Action: actionRedact}, true},
+		{scanFinding{RuleID: "github-pat", Action: actionLog}, false},
+		{scanFinding{RuleID: infraHostRuleID, Action: actionRedact}, false},
+		{scanFinding{RuleID: infraRulePrefix + "aws-account", Action: actionRedact}, false},
+		// [actions] can make an identifier a leak after all
+		{scanFinding{RuleID: infraIPRuleID, Action: actionReject}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.finding.failsScan(); got != tt.want {
+			t.Errorf("failsScan(%s, %q) = %v, want %v", tt.finding.RuleID, tt.finding.Action, got, tt.want)
+		}
+	}
+}
@@ -1,99 +1,404 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"slices"
 	"strings"
+	"sync/atomic"
 
-	"github.com/anthropics/anthropic-sdk-go"
-	"github.com/spf13/viper"
 	"github.com/tidwall/gjson"
-	"github.com/zricethezav/gitleaks/v8/config"
-	"github.com/zricethezav/gitleaks/v8/detect"
+	"github.com/tidwall/sjson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Scanner wraps gitleaks detector with logging.
+// Scanner runs text through an ordered pipeline of inspectors, with gitleaks
+// as one of them, and logs what they find.
 type Scanner struct {
-	detector *detect.Detector
-	log      *slog.Logger
+	inspectors   []Inspector
+	plugins      []Inspector
+	gitleaks     atomic.Pointer[gitleaksEngine]
+	configPaths  []string
+	configFiles  *configFileDetector
+	knownSecrets *knownSecrets
+	honeytokens  *knownSecrets
+	pii          []piiDetector
+	infra        *infraDetector
+	ignore       *ignoreList
+	paths        []pathRule
+	tools        []*toolRule
+	sessions     *sessionStore
+	policy       Policy
+	log          *slog.Logger
+	tracer       trace.Tracer
 }
 
-// ScanResult contains the findings from a scan.
-type ScanResult struct {
-	Secrets []string
+// Finding is a single detected secret.
+type Finding struct {
+	RuleID string
+	// Secret is the exact text that gets redacted. For encoded secrets this is
+	// the whole encoded span rather than the decoded value.
+	Secret string
+	// Replacement overrides the default replacement text, e.g. to keep the
+	// key type of a redacted private key.
+	Replacement string
+	// Encodings lists the encodings peeled off to find the secret, outermost first.
+	Encodings []string
+	// Action is the policy's action for RuleID: redact, reject or log.
+	// Empty means the proxy default.
+	Action string
+	// Confidence is how likely the finding is to be a real secret, from 0 to
+	// 1. Detectors that validate what they find report 1; other findings
+	// are scored once the pipeline has run. 0 means not scored.
+	Confidence float64
+	// Detail is extra context that is safe to log, such as the issuer of a
+	// JWT. It never contains the secret.
+	Detail string
+	// Location is where in the request the secret was found. It is only
+	// known when the request is scanned structurally.
+	Location Location
+	// Fingerprint identifies the finding in .gitleaksignore files.
+	Fingerprint string
 }
 
-// NewScanner creates a Scanner with the given config path.
-// If configPath is empty, uses the default gitleaks config.
-func NewScanner(configPath string, logger *slog.Logger) (*Scanner, error) {
-	log := logger.With("component", "scanner")
+// Location describes which part of a request a piece of text came from.
+type Location struct {
+	// Block is the content block type: text, tool_use, tool_result or system.
+	Block string `json:"block,omitempty"`
+	// ToolName, ToolUseID and Target describe the tool call behind a tool_use
+	// or tool_result block. Target is the file path, command, pattern or URL
+	// the tool was given, when it has one.
+	ToolName  string `json:"tool_name,omitempty"`
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Target    string `json:"target,omitempty"`
+	// Path is the file or directory the tool read, when its input names one.
+	Path string `json:"path,omitempty"`
+}
+
+// toolTargetKeys are the tool input fields that say what a tool looked at,
+// covering Read, Write, Edit, Bash, Grep, Glob and WebFetch.
+var toolTargetKeys = []string{"file_path", "notebook_path", "path", "command", "pattern", "url"}
 
-	var detector *detect.Detector
-	var err error
+// toolPathKeys are the tool input fields that name a file or directory.
+var toolPathKeys = []string{"file_path", "notebook_path", "path"}
 
-	if configPath != "" {
-		cfg, err := loadGitleaksConfig(configPath)
-		if err != nil {
-			return nil, fmt.Errorf("load config from %s: %w", configPath, err)
+// toolCall is a tool_use block: the tool's name and the input it was given.
+type toolCall struct {
+	ID    string
+	Name  string
+	Input any
+}
+
+// toolLocation describes the tool call behind a tool_use or tool_result block.
+// The path of a Bash call is the first file its command names.
+func toolLocation(block string, toolUse toolCall) Location {
+	loc := Location{
+		Block:     block,
+		ToolName:  toolUse.Name,
+		ToolUseID: toolUse.ID,
+		Target:    toolTarget(toolUse.Input),
+		Path:      toolPath(toolUse.Input),
+	}
+	if loc.ToolName == "Bash" {
+		if paths := commandPaths(loc.Target); len(paths) > 0 {
+			loc.Path = paths[0]
 		}
-		log.Info("loaded custom gitleaks config", "path", configPath, "rules", len(cfg.Rules))
-		detector = detect.NewDetector(cfg)
-	} else {
-		detector, err = detect.NewDetectorDefaultConfig()
-		if err != nil {
-			return nil, fmt.Errorf("create default gitleaks detector: %w", err)
+	}
+	return loc
+}
+
+// toolPath returns the file or directory named in a tool_use input.
+func toolPath(input any) string {
+	fields, ok := input.(map[string]any)
+	if !ok {
+		return ""
+	}
+	for _, key := range toolPathKeys {
+		if v, ok := fields[key].(string); ok && v != "" {
+			return v
 		}
-		log.Info("using default gitleaks config")
 	}
+	return ""
+}
 
-	return &Scanner{detector: detector, log: log}, nil
+// toolTarget picks the most descriptive field out of a tool_use input.
+func toolTarget(input any) string {
+	fields, ok := input.(map[string]any)
+	if !ok {
+		return ""
+	}
+	for _, key := range toolTargetKeys {
+		if v, ok := fields[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
 }
 
-func loadGitleaksConfig(configPath string) (config.Config, error) {
-	v := viper.New()
-	v.SetConfigFile(configPath)
-	v.SetConfigType("toml")
+// ScanResult contains the findings from a scan.
+type ScanResult struct {
+	Findings []Finding
+}
+
+// Honeytokens returns the findings that matched the honeytoken registry.
+func (r ScanResult) Honeytokens() []Finding {
+	var tripped []Finding
+	for _, f := range r.Findings {
+		if strings.HasPrefix(f.RuleID, honeytokenRuleID+":") {
+			tripped = append(tripped, f)
+		}
+	}
+	return tripped
+}
+
+// Rejecting returns the findings that call for rejecting the request.
+// rejectByDefault is the action for findings without a per-rule action.
+func (r ScanResult) Rejecting(rejectByDefault bool) []Finding {
+	var rejecting []Finding
+	for _, f := range r.Findings {
+		if f.Action == actionReject || f.Action == "" && rejectByDefault {
+			rejecting = append(rejecting, f)
+		}
+	}
+	return rejecting
+}
+
+// setLocation records loc on every finding and fingerprints it.
+func (s *Scanner) setLocation(findings []Finding, loc Location) {
+	for i := range findings {
+		findings[i].Location = loc
+		findings[i].Fingerprint = s.ignore.Fingerprint(findings[i])
+	}
+}
+
+// NewScanner creates a Scanner with the gitleaks configs at configPaths
+// layered in order, on top of the default config if they extend it.
+// If configPaths is empty, uses the default gitleaks config.
+func NewScanner(configPaths []string, policy Policy, logger *slog.Logger) (*Scanner, error) {
+	log := logger.With("component", "scanner")
+
+	engine, err := newGitleaksEngine(configPaths, policy.Feedback.Config, policy.Decode.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	logGitleaksConfig(log, "loaded gitleaks config", engine.rules)
+	if err := runSelfTest(log, engine, policy.SelfTest); err != nil {
+		return nil, err
+	}
+
+	configFiles, err := newConfigFileDetector(policy.ConfigFiles.SensitiveKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	knownSecrets, err := newKnownSecrets(knownSecretRuleID, policy.KnownSecrets, logger)
+	if err != nil {
+		return nil, fmt.Errorf("load known secrets: %w", err)
+	}
+
+	honeytokens, err := newKnownSecrets(honeytokenRuleID, policy.Honeytokens.KnownSecretsPolicy, logger)
+	if err != nil {
+		return nil, fmt.Errorf("load honeytokens: %w", err)
+	}
 
-	if err := v.ReadInConfig(); err != nil {
-		return config.Config{}, fmt.Errorf("read config file: %w", err)
+	pii, err := newPIIDetectors(policy.PII)
+	if err != nil {
+		return nil, err
 	}
 
-	var vc config.ViperConfig
-	if err := v.Unmarshal(&vc); err != nil {
-		return config.Config{}, fmt.Errorf("unmarshal config: %w", err)
+	infra, err := newInfraDetector(policy.Infra)
+	if err != nil {
+		return nil, err
 	}
 
-	cfg, err := vc.Translate()
+	ignorePolicy := policy.Ignore
+	if policy.Feedback.IgnoreFile != "" {
+		ignorePolicy.Files = append(slices.Clone(ignorePolicy.Files), policy.Feedback.IgnoreFile)
+	}
+	ignore, err := newIgnoreList(ignorePolicy, logger)
 	if err != nil {
-		return config.Config{}, fmt.Errorf("translate config: %w", err)
+		return nil, err
 	}
 
-	return cfg, nil
+	paths, err := newPathRules(policy.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Scanner{
+		configPaths:  configPaths,
+		configFiles:  configFiles,
+		knownSecrets: knownSecrets,
+		honeytokens:  honeytokens,
+		pii:          pii,
+		infra:        infra,
+		ignore:       ignore,
+		paths:        paths,
+		sessions:     newSessionStore(policy.SessionTTL),
+		policy:       policy,
+		log:          log,
+		tracer:       otel.Tracer("gitleaks-proxy"),
+	}
+	s.gitleaks.Store(engine)
+
+	// from here on, what is already running is stopped if a later step fails
+	s.plugins, err = loadWasmPlugins(policy.Plugins, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	external, err := startExternalDetectors(policy.External, logger)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	s.plugins = append(s.plugins, external...)
+	available := s.availableInspectors(s.plugins)
+	s.inspectors, err = s.buildPipeline(available, policy.Inspectors, s.plugins)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.tools, err = s.newToolRules(policy.Tools, available)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
 }
 
-// scans text for API key leaks and returns the result
-func (s *Scanner) Scan(text string) ScanResult {
-	s.log.Debug("scanning text", "length", len(text))
+func logGitleaksConfig(log *slog.Logger, msg string, cfg layeredConfig) {
+	for _, warning := range cfg.Warnings {
+		log.Warn("gitleaks config", "warning", warning)
+	}
+	log.Info(msg, "layers", cfg.Layers, "rules", len(cfg.Config.Rules), "hash", cfg.Hash)
+}
 
-	fragment := detect.Fragment{Raw: text}
-	leaks := s.detector.Detect(fragment)
+// ReloadConfig rebuilds the gitleaks detector from the config files and
+// swaps it in; scans already running finish with the old one. On error the
+// current detector stays active.
+func (s *Scanner) ReloadConfig() error {
+	engine, err := newGitleaksEngine(s.configPaths, s.policy.Feedback.Config, s.policy.Decode.MaxDepth)
+	if err != nil {
+		return err
+	}
+	if err := runSelfTest(s.log, engine, s.policy.SelfTest); err != nil {
+		return err
+	}
+	previous := s.gitleaks.Swap(engine)
+	if previous.rules.Hash == engine.rules.Hash {
+		s.log.Debug("gitleaks config unchanged", "hash", engine.rules.Hash)
+		return nil
+	}
+	logGitleaksConfig(s.log.With("previous_hash", previous.rules.Hash), "reloaded gitleaks config", engine.rules)
+	return nil
+}
 
-	result := ScanResult{
-		Secrets: make([]string, 0, len(leaks)),
+// Close stops the external detectors and plugins. The scanner must not be
+// used afterwards.
+func (s *Scanner) Close() {
+	for _, plugin := range s.plugins {
+		if closer, ok := plugin.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				s.log.Warn("failed to close detector", "inspector", plugin.Name(), "error", err)
+			}
+		}
 	}
+}
+
+// Scan runs the inspector pipeline over text, which came from loc in the
+// request, and returns the findings.
+func (s *Scanner) Scan(ctx context.Context, text string, loc Location) ScanResult {
+	s.log.Debug("scanning text", "length", len(text))
 
-	for _, leak := range leaks {
-		s.log.Info("leak detected", "rule", leak.RuleID, "secret", truncate(leak.Secret))
-		result.Secrets = append(result.Secrets, leak.Secret)
+	result := ScanResult{
+		Findings: s.inspect(ctx, text, loc, 0),
+	}
+	s.setLocation(result.Findings, loc)
+	result.Findings = s.dropIgnored(text, result.Findings)
+	result.Findings = s.applyPathPolicy(loc, result.Findings)
+
+	for _, f := range result.Findings {
+		attrs := []any{"rule", f.RuleID, "secret", truncate(f.Secret), "fingerprint", f.Fingerprint}
+		if len(f.Encodings) > 0 {
+			attrs = append(attrs, "encodings", f.Encodings)
+		}
+		if f.Detail != "" {
+			attrs = append(attrs, "detail", f.Detail)
+		}
+		if f.Action != "" {
+			attrs = append(attrs, "action", f.Action)
+		}
+		if f.Confidence > 0 {
+			attrs = append(attrs, "confidence", f.Confidence)
+		}
+		s.log.Info("leak detected", attrs...)
 	}
 
 	return result
 }
 
+// dropIgnored removes the findings listed in an ignore file, and in tool
+// results those on lines marked gitleaks:allow. Registered secrets and
+// honeytokens are always kept: a marker must not be able to smuggle them out.
+func (s *Scanner) dropIgnored(text string, findings []Finding) []Finding {
+	return slices.DeleteFunc(findings, func(f Finding) bool {
+		if strings.HasPrefix(f.RuleID, knownSecretRuleID+":") || strings.HasPrefix(f.RuleID, honeytokenRuleID+":") {
+			return false
+		}
+		switch {
+		case s.ignore.Ignored(f, text):
+			s.log.Info("finding ignored", "rule", f.RuleID, "fingerprint", f.Fingerprint)
+			return true
+		case s.policy.Ignore.AllowMarkers && f.Location.Block == "tool_result" && allowedByMarker(text, f.Secret):
+			s.log.Info("finding allowed by marker", "rule", f.RuleID, "fingerprint", f.Fingerprint)
+			return true
+		}
+		return false
+	})
+}
+
+// detectRegistered matches text against the honeytoken and known-secrets
+// registries, for the request fields the pipeline does not see.
+func (s *Scanner) detectRegistered(text string) []Finding {
+	findings := append(s.honeytokens.Detect(text), s.knownSecrets.Detect(text)...)
+	s.setLocation(findings, Location{})
+	return s.withActions(findings)
+}
+
+// withActions sets the policy's per-rule action on each finding. Findings
+// keep the action their detector gave them unless the policy overrides it.
+func (s *Scanner) withActions(findings []Finding) []Finding {
+	for i := range findings {
+		if action := s.policy.Action(findings[i].RuleID); action != "" {
+			findings[i].Action = action
+		}
+	}
+	return findings
+}
+
+// dedupeFindings drops repeated findings of the same secret by the same rule.
+func dedupeFindings(findings []Finding) []Finding {
+	seen := make(map[string]struct{}, len(findings))
+	return slices.DeleteFunc(findings, func(f Finding) bool {
+		key := f.RuleID + "\x00" + f.Secret
+		if _, ok := seen[key]; ok {
+			return true
+		}
+		seen[key] = struct{}{}
+		return false
+	})
+}
+
 // ScanRequestBody extracts the messages field from a JSON body and scans it.
 // Falls back to scanning the entire body if no messages field exists.
-func (s *Scanner) ScanRequestBody(body []byte) ScanResult {
+func (s *Scanner) ScanRequestBody(ctx context.Context, body []byte) ScanResult {
 	bodyStr := string(body)
 
 	// Extract messages array if present, otherwise scan entire body
@@ -107,164 +412,199 @@ func (s *Scanner) ScanRequestBody(body []byte) ScanResult {
 		s.log.Debug("no messages field, scanning entire body", "length", len(textToScan))
 	}
 
-	return s.Scan(textToScan)
+	result := s.Scan(ctx, textToScan, Location{})
+
+	// Registered secrets are redacted from every request field, not just messages
+	result.Findings = dedupeFindings(append(result.Findings, s.detectRegistered(bodyStr)...))
+
+	return result
 }
 
-// ScanAndReplaceRequestBody scans and replaces secrets in the request body by properly
-// parsing the Anthropic API request structure. Returns the scan result and modified body.
+// ScanAndReplaceRequestBody scans and replaces secrets in the request body by walking
+// the Anthropic API request structure. Returns the scan result and modified body.
+// Infrastructure identifiers are replaced with the pseudonyms of the request's session.
 // This is slower but safer than raw string scanning, as it only scans actual text content
 // and avoids false positives from JSON structure.
-// The issue with this is that any changes upstream in anthropic's response may potentially break this
-func (s *Scanner) ScanAndReplaceRequestBody(body []byte, replacement string) (ScanResult, []byte, error) {
-	// Try to unmarshal into MessageNewParams
-	var params anthropic.MessageNewParams
-	if err := json.Unmarshal(body, &params); err != nil {
-		s.log.Debug("failed to parse, using string replacement", "error", err)
-		result := s.ScanRequestBody(body)
-		modifiedBody := body
-		for _, secret := range result.Secrets {
-			modifiedBody = []byte(strings.ReplaceAll(string(modifiedBody), secret, replacement))
-		}
-		return result, modifiedBody, nil
+// Each redaction is written back into the original JSON at the path of its block, so
+// fields this walk does not know about reach upstream unchanged.
+func (s *Scanner) ScanAndReplaceRequestBody(ctx context.Context, body []byte, replacement string) (ScanResult, []byte, error) {
+	session := s.sessions.Session(sessionKey(body))
+
+	if !gjson.ValidBytes(body) {
+		s.log.Debug("invalid JSON, using string replacement")
+		return s.scanAndReplaceRaw(ctx, body, session, replacement)
 	}
+	request := gjson.ParseBytes(body)
 
 	result := ScanResult{
-		Secrets: make([]string, 0),
+		Findings: make([]Finding, 0),
 	}
-
+	modifiedBody := slices.Clone(body)
 	textScanned := 0
+	var errs []error
 
-	// Process each message
-	for i := range params.Messages {
-		msg := &params.Messages[i]
-		s.log.Debug("processing message", "index", i, "role", msg.Role)
-
-		for j := range msg.Content {
-			content := &msg.Content[j]
-			s.log.Debug("processing content block", "message_index", i, "block_index", j)
-
-			// Text blocks
-			if content.OfText != nil {
-				text := content.OfText.Text
-				if text != "" {
-					textScanned += len(text)
-					scanResult := s.Scan(text)
-					result.Secrets = append(result.Secrets, scanResult.Secrets...)
-
-					// Replace secrets in-place
-					for _, secret := range scanResult.Secrets {
-						content.OfText.Text = strings.ReplaceAll(content.OfText.Text, secret, replacement)
-					}
-					s.log.Debug("scanned text block", "length", len(text), "secrets_found", len(scanResult.Secrets))
-				}
+	// scanText scans the string at path and writes the redacted text back
+	scanText := func(path, text string, loc Location) {
+		if text == "" {
+			return
+		}
+		textScanned += len(text)
+		scanResult := s.Scan(ctx, text, loc)
+		result.Findings = append(result.Findings, scanResult.Findings...)
+		s.log.Debug("scanned block", "path", path, "length", len(text), "secrets_found", len(scanResult.Findings))
+
+		redacted := redact(text, session.Apply(scanResult.Findings), replacement)
+		if redacted == text {
+			return
+		}
+		var err error
+		if modifiedBody, err = sjson.SetBytes(modifiedBody, path, redacted); err != nil {
+			errs = append(errs, fmt.Errorf("rewrite %s: %w", path, err))
+		}
+	}
+
+	// scanInput scans the raw JSON of a tool_use input at path and writes the
+	// redacted JSON back
+	scanInput := func(path string, input gjson.Result, loc Location) {
+		if !input.Exists() {
+			return
+		}
+		textScanned += len(input.Raw)
+		scanResult := s.Scan(ctx, input.Raw, loc)
+		result.Findings = append(result.Findings, scanResult.Findings...)
+		s.log.Debug("scanned tool_use input", "path", path, "length", len(input.Raw), "secrets_found", len(scanResult.Findings))
+
+		redacted := redact(input.Raw, session.Apply(scanResult.Findings), replacement)
+		if redacted == input.Raw {
+			return
+		}
+		if !gjson.Valid(redacted) {
+			errs = append(errs, fmt.Errorf("rewrite %s: redacted input is not valid JSON", path))
+			return
+		}
+		var err error
+		if modifiedBody, err = sjson.SetRawBytes(modifiedBody, path, []byte(redacted)); err != nil {
+			errs = append(errs, fmt.Errorf("rewrite %s: %w", path, err))
+		}
+	}
+
+	messages := request.Get("messages").Array()
+
+	// Remember every tool call so tool results can be traced back to the tool
+	// and input that produced them
+	toolUses := make(map[string]toolCall)
+	for _, msg := range messages {
+		for _, block := range msg.Get("content").Array() {
+			if block.Get("type").String() == "tool_use" {
+				id := block.Get("id").String()
+				toolUses[id] = toolCall{ID: id, Name: block.Get("name").String(), Input: block.Get("input").Value()}
 			}
+		}
+	}
 
-			// Tool use blocks - scan the input
-			// The input is an any type, hence the need to marshall, we don't exactly know the
-			// input?
-			// quick ref https://github.com/anthropics/anthropic-sdk-go/blob/09e977d786cebc0edd2fb52ca18f809ca939ea47/message.go#L4140
-			if content.OfToolUse != nil && content.OfToolUse.Input != nil {
-				if inputJSON, err := json.Marshal(content.OfToolUse.Input); err == nil {
-					textScanned += len(inputJSON)
-					scanResult := s.Scan(string(inputJSON))
-					result.Secrets = append(result.Secrets, scanResult.Secrets...)
-
-					// Replace secrets in the input by unmarshaling, replacing, and remarshaling
-					if len(scanResult.Secrets) > 0 {
-						inputStr := string(inputJSON)
-						for _, secret := range scanResult.Secrets {
-							inputStr = strings.ReplaceAll(inputStr, secret, replacement)
-						}
-						var newInput any
-						if err := json.Unmarshal([]byte(inputStr), &newInput); err == nil {
-							content.OfToolUse.Input = newInput
-						}
-					}
-					s.log.Debug("scanned tool_use input", "length", len(inputJSON), "secrets_found", len(scanResult.Secrets))
+	// Process each message. Content is either a string or a list of blocks;
+	// images, documents and thinking blocks are not scanned.
+	for i, msg := range messages {
+		s.log.Debug("processing message", "index", i, "role", msg.Get("role").String())
+		content := msg.Get("content")
+		contentPath := fmt.Sprintf("messages.%d.content", i)
+		if content.Type == gjson.String {
+			scanText(contentPath, content.String(), Location{Block: "text"})
+			continue
+		}
+
+		for j, block := range content.Array() {
+			blockPath := fmt.Sprintf("%s.%d", contentPath, j)
+			switch block.Get("type").String() {
+			case "text":
+				scanText(blockPath+".text", block.Get("text").String(), Location{Block: "text"})
+
+			case "tool_use":
+				scanInput(blockPath+".input", block.Get("input"), toolLocation("tool_use", toolUses[block.Get("id").String()]))
+
+			case "tool_result":
+				toolUseID := block.Get("tool_use_id").String()
+				loc := Location{Block: "tool_result", ToolUseID: toolUseID}
+				if toolUse, ok := toolUses[toolUseID]; ok {
+					loc = toolLocation("tool_result", toolUse)
 				}
-			}
 
-			// Tool result blocks
-			// quick ref of the struct in messages.go
-			// https://github.com/anthropics/anthropic-sdk-go/blob/09e977d786cebc0edd2fb52ca18f809ca939ea47/message.go#L3620
-			if content.OfToolResult != nil {
-				// Process each content block in the tool result
-				for k := range content.OfToolResult.Content {
-					toolResultContent := &content.OfToolResult.Content[k]
-
-					// Handle text blocks in tool results
-					if toolResultContent.OfText != nil {
-						text := toolResultContent.OfText.Text
-						if text != "" {
-							textScanned += len(text)
-							scanResult := s.Scan(text)
-							result.Secrets = append(result.Secrets, scanResult.Secrets...)
-
-							// Replace secrets in-place
-							for _, secret := range scanResult.Secrets {
-								toolResultContent.OfText.Text = strings.ReplaceAll(toolResultContent.OfText.Text, secret, replacement)
-							}
-							s.log.Debug("scanned tool_result text", "length", len(text), "secrets_found", len(scanResult.Secrets))
-						}
+				resultContent := block.Get("content")
+				if resultContent.Type == gjson.String {
+					scanText(blockPath+".content", resultContent.String(), loc)
+					continue
+				}
+				for k, resultBlock := range resultContent.Array() {
+					if resultBlock.Get("type").String() == "text" {
+						scanText(fmt.Sprintf("%s.content.%d.text", blockPath, k), resultBlock.Get("text").String(), loc)
 					}
-					// TODO: In tool result, there are other fields like documents and urls
+					// TODO: In tool result, there are other blocks like images and documents
 					// should we scan them as well?
 				}
 			}
-			// in messages.go, there are these other fields, just for reference as they may change
-			//  type ContentBlockParamUnion struct {
-			// 	OfText                *TextBlockParam                `json:",omitzero,inline"`
-			// 	OfImage               *ImageBlockParam               `json:",omitzero,inline"`
-			// 	OfDocument            *DocumentBlockParam            `json:",omitzero,inline"`
-			// 	OfSearchResult        *SearchResultBlockParam        `json:",omitzero,inline"`
-			// 	OfThinking            *ThinkingBlockParam            `json:",omitzero,inline"`
-			// 	OfRedactedThinking    *RedactedThinkingBlockParam    `json:",omitzero,inline"`
-			// 	OfToolUse             *ToolUseBlockParam             `json:",omitzero,inline"`
-			// 	OfToolResult          *ToolResultBlockParam          `json:",omitzero,inline"`
-			// 	OfServerToolUse       *ServerToolUseBlockParam       `json:",omitzero,inline"`
-			// 	OfWebSearchToolResult *WebSearchToolResultBlockParam `json:",omitzero,inline"`
-			// 	paramUnion
-			// }
 		}
 	}
 
-	// Process system prompt
-	if params.System != nil {
-		for i := range params.System {
-			sysBlock := &params.System[i]
-			if sysBlock.Text != "" {
-				textScanned += len(sysBlock.Text)
-				scanResult := s.Scan(sysBlock.Text)
-				result.Secrets = append(result.Secrets, scanResult.Secrets...)
-
-				// Replace secrets in system prompt
-				for _, secret := range scanResult.Secrets {
-					sysBlock.Text = strings.ReplaceAll(sysBlock.Text, secret, replacement)
-				}
-				s.log.Debug("scanned system prompt", "length", len(sysBlock.Text), "secrets_found", len(scanResult.Secrets))
-			}
+	// Process system prompt, a string or a list of text blocks
+	if system := request.Get("system"); system.Type == gjson.String {
+		scanText("system", system.String(), Location{Block: "system"})
+	} else {
+		for i, block := range system.Array() {
+			scanText(fmt.Sprintf("system.%d.text", i), block.Get("text").String(), Location{Block: "system"})
 		}
 	}
 
 	// If no text was scanned, fall back to raw scan
 	if textScanned == 0 {
 		s.log.Debug("no structured content found, falling back to raw scan")
-		result = s.ScanRequestBody(body)
-		return result, body, nil
+		return s.scanAndReplaceRaw(ctx, body, session, replacement)
 	}
 
-	s.log.Debug("structured scan complete", "text_scanned", textScanned, "total_secrets", len(result.Secrets))
+	s.log.Debug("structured scan complete", "text_scanned", textScanned, "total_secrets", len(result.Findings))
+	if len(errs) > 0 {
+		// the caller falls back to redacting the original body with the
+		// findings, so they must cover registered secrets anywhere in it
+		result.Findings = dedupeFindings(append(result.Findings, s.detectRegistered(string(body))...))
+		return result, body, errors.Join(errs...)
+	}
 
-	// Marshal back to JSON
-	modifiedBody, err := json.Marshal(params)
-	if err != nil {
-		s.log.Error("failed to marshal modified params", "error", err)
-		return result, body, fmt.Errorf("marshal modified params: %w", err)
+	// Registered secrets are redacted from every request field, including the
+	// ones the structured walk above does not look at
+	if known := s.detectRegistered(string(modifiedBody)); len(known) > 0 {
+		result.Findings = dedupeFindings(append(result.Findings, known...))
+		modifiedBody = []byte(redact(string(modifiedBody), known, replacement))
 	}
 
 	return result, modifiedBody, nil
 }
 
+// scanAndReplaceRaw scans a body that has no content blocks to walk as a
+// string and redacts what it finds anywhere in it.
+func (s *Scanner) scanAndReplaceRaw(ctx context.Context, body []byte, session *session, replacement string) (ScanResult, []byte, error) {
+	result := s.ScanRequestBody(ctx, body)
+	return result, []byte(redact(string(body), session.Apply(result.Findings), replacement)), nil
+}
+
+// redact replaces every occurrence of each finding's secret in text, with the
+// finding's own replacement if it has one. Log-only findings are left alone.
+// Longer secrets are replaced first so that an encoded span or key block is
+// not broken up by a shorter secret that happens to occur inside it.
+func redact(text string, findings []Finding, replacement string) string {
+	sorted := slices.Clone(findings)
+	slices.SortStableFunc(sorted, func(a, b Finding) int { return len(b.Secret) - len(a.Secret) })
+	for _, f := range sorted {
+		if f.Secret == "" || f.Action == actionLog {
+			continue
+		}
+		if f.Replacement != "" {
+			text = strings.ReplaceAll(text, f.Secret, f.Replacement)
+			continue
+		}
+		text = strings.ReplaceAll(text, f.Secret, replacement)
+	}
+	return text
+}
+
 // truncate returns a truncated version of the string for safe logging.
 // If the string is shorter than 8, returns "********".
 // Otherwise, shows first 2 chars + "****" + last 2 chars.
@@ -0,0 +1,150 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/zricethezav/gitleaks/v8/detect"
+)
+
+// builtinExamples are the examples shipped with the proxy, for common
+// built-in rules and the rules in the repository's .gitleaks.toml.
+//
+//go:embed selftest/examples.toml
+var builtinExamples string
+
+// Self-test modes.
+const (
+	// selfTestWarn logs failing examples and loads the config anyway.
+	selfTestWarn = "warn"
+	// selfTestFail refuses a config with failing examples.
+	selfTestFail = "fail"
+	// selfTestOff skips the self-test.
+	selfTestOff = "off"
+)
+
+// ruleExample is text a rule must find a secret in, and text it must not.
+type ruleExample struct {
+	Rule    string   `mapstructure:"rule"`
+	Match   []string `mapstructure:"match"`
+	NoMatch []string `mapstructure:"no_match"`
+}
+
+// selfTestFailure is an example a rule got wrong.
+type selfTestFailure struct {
+	Rule string
+	Text string
+	// Match is true if the rule should have found a secret in Text.
+	Match bool
+}
+
+func (f selfTestFailure) String() string {
+	text, _, cut := strings.Cut(f.Text, "\n")
+	if cut {
+		text += " ..."
+	}
+	if f.Match {
+		return fmt.Sprintf("%s: no secret found in %q", f.Rule, text)
+	}
+	return fmt.Sprintf("%s: unexpected secret found in %q", f.Rule, text)
+}
+
+// loadRuleExamples returns the built-in examples followed by those in the
+// files at paths.
+func loadRuleExamples(paths []string) ([]ruleExample, error) {
+	examples, err := parseRuleExamples(builtinExamples)
+	if err != nil {
+		return nil, fmt.Errorf("parse built-in examples: %w", err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read examples: %w", err)
+		}
+		more, err := parseRuleExamples(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("parse examples from %s: %w", path, err)
+		}
+		examples = append(examples, more...)
+	}
+	return examples, nil
+}
+
+func parseRuleExamples(data string) ([]ruleExample, error) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	if err := v.ReadConfig(strings.NewReader(data)); err != nil {
+		return nil, err
+	}
+	var file struct {
+		Examples []ruleExample `mapstructure:"examples"`
+	}
+	if err := v.Unmarshal(&file); err != nil {
+		return nil, err
+	}
+	for i, example := range file.Examples {
+		if example.Rule == "" {
+			return nil, fmt.Errorf("examples[%d] needs a rule", i)
+		}
+	}
+	return file.Examples, nil
+}
+
+// selfTest runs every example through detector and returns the ones its rule
+// got wrong. Examples for rules the config does not have are skipped, so the
+// built-in examples still apply to a config that drops some default rules.
+func selfTest(detector *detect.Detector, examples []ruleExample) (failures []selfTestFailure, skipped []string) {
+	for _, example := range examples {
+		if _, ok := detector.Config.Rules[example.Rule]; !ok {
+			skipped = append(skipped, example.Rule)
+			continue
+		}
+		for _, text := range example.Match {
+			if !detects(detector, example.Rule, text) {
+				failures = append(failures, selfTestFailure{Rule: example.Rule, Text: text, Match: true})
+			}
+		}
+		for _, text := range example.NoMatch {
+			if detects(detector, example.Rule, text) {
+				failures = append(failures, selfTestFailure{Rule: example.Rule, Text: text})
+			}
+		}
+	}
+	return failures, skipped
+}
+
+// detects reports whether rule finds a secret in text.
+func detects(detector *detect.Detector, rule, text string) bool {
+	for _, f := range detector.DetectString(text) {
+		if f.RuleID == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// runSelfTest runs the examples against a freshly loaded engine according to
+// policy: failures are logged, and with the fail mode the engine is refused.
+func runSelfTest(log *slog.Logger, engine *gitleaksEngine, policy SelfTestPolicy) error {
+	if policy.Mode == selfTestOff {
+		return nil
+	}
+	examples, err := loadRuleExamples(policy.Examples)
+	if err != nil {
+		return err
+	}
+	failures, _ := selfTest(engine.detector, examples)
+	for _, failure := range failures {
+		log.Warn("gitleaks rule self-test failed", "rule", failure.Rule, "match", failure.Match)
+	}
+	if len(failures) > 0 && policy.Mode == selfTestFail {
+		return errors.New("gitleaks rule self-test failed, run `claude-gitleaks config check` for details")
+	}
+	log.Debug("gitleaks rule self-test done", "examples", len(examples), "failures", len(failures))
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zricethezav/gitleaks/v8/detect"
+)
+
+func TestParseRuleExamples(t *testing.T) {
+	examples, err := parseRuleExamples(`
+[[examples]]
+rule = "acme-token"
+match = ["acme_live_x7Kq2VmN9pL4"]
+no_match = ["acme_test"]
+`)
+	if err != nil {
+		t.Fatalf("parseRuleExamples: %v", err)
+	}
+	want := []ruleExample{{Rule: "acme-token", Match: []string{"acme_live_x7Kq2VmN9pL4"}, NoMatch: []string{"acme_test"}}}
+	if len(examples) != 1 || examples[0].Rule != want[0].Rule ||
+		!slices.Equal(examples[0].Match, want[0].Match) || !slices.Equal(examples[0].NoMatch, want[0].NoMatch) {
+		t.Errorf("examples = %+v, want %+v", examples, want)
+	}
+
+	if _, err := parseRuleExamples("[[examples]]\nmatch = [\"x\"]\n"); err == nil {
+		t.Error("parseRuleExamples accepted an example without a rule")
+	}
+	if _, err := loadRuleExamples(nil); err != nil {
+		t.Errorf("built-in examples: %v", err)
+	}
+}
+
+// TestBuiltinExamples keeps the shipped examples in step with the default
+// gitleaks rules.
+func TestBuiltinExamples(t *testing.T) {
+	examples, err := loadRuleExamples(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check, err := checkGitleaksConfig(nil, "", examples)
+	if err != nil {
+		t.Fatalf("checkGitleaksConfig: %v", err)
+	}
+	for _, f := range check.Failures {
+		t.Errorf("default config: %s", f)
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	project := writeLayer(t, t.TempDir(), "project.toml", `
+[[rules]]
+id = "acme-token"
+regex = '''acme_live_[a-z0-9]{8}\b'''
+keywords = ["acme_live_"]
+`)
+	cfg, err := loadGitleaksConfig([]string{project}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures, skipped := selfTest(detect.NewDetector(cfg.Config), []ruleExample{
+		{Rule: "acme-token", Match: []string{"key acme_live_x7kq2vmn", "acme_live_SHORT\nsecond line"}, NoMatch: []string{"acme_live_", "acme_live_abcdefgh"}},
+		{Rule: "not-in-config", Match: []string{"anything"}},
+	})
+	if !slices.Equal(skipped, []string{"not-in-config"}) {
+		t.Errorf("skipped = %v", skipped)
+	}
+	want := []selfTestFailure{
+		{Rule: "acme-token", Text: "acme_live_SHORT\nsecond line", Match: true},
+		{Rule: "acme-token", Text: "acme_live_abcdefgh"},
+	}
+	if !slices.Equal(failures, want) {
+		t.Fatalf("failures = %+v, want %+v", failures, want)
+	}
+	if got := failures[0].String(); !strings.Contains(got, "no secret found") || !strings.Contains(got, `SHORT ...`) {
+		t.Errorf("String() = %q", got)
+	}
+	if got := failures[1].String(); !strings.Contains(got, "unexpected secret found") {
+		t.Errorf("String() = %q", got)
+	}
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -20,30 +27,151 @@ import (
 type Proxy struct {
 	upstream     *url.URL
 	client       *http.Client
-	scanner      *Scanner
+	scanner      atomic.Pointer[Scanner]
+	configPaths  []string
+	logger       *slog.Logger
+	reloadMu     sync.Mutex
 	rejectOnLeak bool
+	structured   bool
+	audit        *auditLog
+	capture      *captureLog
+	stats        *ruleCounters
 	tracer       trace.Tracer
 }
 
 // NewProxy creates a new proxy with the given configuration.
-func NewProxy(upstreamURL string, rejectOnLeak bool, configPath string, logger *slog.Logger) (*Proxy, error) {
+// If structured is set, request bodies are parsed as Anthropic messages and each
+// content block is scanned on its own, which enables the tool-aware detectors.
+func NewProxy(upstreamURL string, rejectOnLeak, structured bool, configPaths []string, policy Policy, logger *slog.Logger) (*Proxy, error) {
 	upstream, err := url.Parse(upstreamURL)
 	if err != nil {
 		return nil, fmt.Errorf("parse upstream URL: %w", err)
 	}
 
-	scanner, err := NewScanner(configPath, logger)
+	scanner, err := NewScanner(configPaths, policy, logger)
 	if err != nil {
 		return nil, fmt.Errorf("create scanner: %w", err)
 	}
 
-	return &Proxy{
+	audit, err := newAuditLog(policy.Honeytokens.AuditLog)
+	if err != nil {
+		scanner.Close()
+		return nil, err
+	}
+
+	capture, err := newCaptureLog(policy.Capture)
+	if err != nil {
+		audit.Close()
+		scanner.Close()
+		return nil, err
+	}
+
+	p := &Proxy{
 		upstream:     upstream,
 		client:       &http.Client{},
-		scanner:      scanner,
+		configPaths:  configPaths,
+		logger:       logger,
 		rejectOnLeak: rejectOnLeak,
+		structured:   structured,
+		audit:        audit,
+		capture:      capture,
+		stats:        newRuleCounters(),
 		tracer:       otel.Tracer("gitleaks-proxy"),
-	}, nil
+	}
+	p.scanner.Store(scanner)
+	return p, nil
+}
+
+// The server's timeouts. The write timeout runs from the end of the request
+// headers, so it covers reading the body and scanning it as well.
+const (
+	serverReadTimeout  = 30 * time.Second
+	serverWriteTimeout = 90 * time.Second
+)
+
+// scannerDrainTime is how long a replaced scanner is kept before its external
+// detectors and plugins are stopped. A request picks its scanner once its
+// body is read and is done with it before it is forwarded, so its scan ends
+// within the write timeout, after which its response could not be written
+// anyway; the margin covers scans that overrun it.
+const scannerDrainTime = 2 * serverWriteTimeout
+
+// Reload re-reads the policy at policyPath, the gitleaks configs, the
+// sources of the known-secrets and honeytoken registries and the ignore
+// files. A changed policy builds a new scanner, which takes over the
+// sessions of the old one; otherwise only the gitleaks detector is rebuilt.
+// Requests in flight finish with what they started with, and anything that
+// fails to load leaves the current state in place.
+func (p *Proxy) Reload(policyPath string) error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	policy, err := loadPolicy(policyPath)
+	if err != nil {
+		return fmt.Errorf("load policy: %w", err)
+	}
+
+	current := p.scanner.Load()
+	if reflect.DeepEqual(policy, current.policy) {
+		return errors.Join(current.ReloadConfig(), current.knownSecrets.Load(), current.honeytokens.Load(), current.ignore.Load())
+	}
+
+	next, err := NewScanner(p.configPaths, policy, p.logger)
+	if err != nil {
+		return fmt.Errorf("create scanner: %w", err)
+	}
+	current.sessions.SetTTL(policy.SessionTTL)
+	next.sessions = current.sessions
+	p.scanner.Store(next)
+	time.AfterFunc(scannerDrainTime, current.Close)
+
+	slog.Info("reloaded policy", "path", policyPath)
+	if policy.Honeytokens.AuditLog != current.policy.Honeytokens.AuditLog {
+		slog.Warn("audit log path changes take effect on restart", "path", current.policy.Honeytokens.AuditLog)
+	}
+	if policy.Capture != current.policy.Capture {
+		slog.Warn("capture changes take effect on restart", "path", current.policy.Capture.File)
+	}
+	return nil
+}
+
+// WatchedFiles lists the files whose changes trigger a reload: the policy at
+// policyPath, every gitleaks config layer, including the files they extend
+// and the feedback overlay, the known-secrets and honeytoken files and the
+// ignore files.
+func (p *Proxy) WatchedFiles(policyPath string) []string {
+	scanner := p.scanner.Load()
+	var files []string
+	if policyPath != "" {
+		files = append(files, policyPath)
+	}
+	files = append(files, p.configPaths...)
+	for _, layer := range scanner.gitleaks.Load().rules.Layers {
+		if layer != defaultLayer {
+			files = append(files, layer)
+		}
+	}
+	if scanner.policy.Feedback.Config != "" {
+		files = append(files, scanner.policy.Feedback.Config)
+	}
+	files = append(files, scanner.policy.KnownSecrets.Files...)
+	files = append(files, scanner.policy.Honeytokens.Files...)
+	files = append(files, scanner.ignore.policy.Files...)
+	slices.Sort(files)
+	return slices.Compact(files)
+}
+
+// Close stops the external detectors and plugins of the active scanner and
+// closes the audit and capture logs. Scanners replaced by a reload are closed
+// once they have drained.
+func (p *Proxy) Close() {
+	p.scanner.Load().Close()
+	if err := p.audit.Close(); err != nil {
+		slog.Error("failed to close audit log", "error", err)
+	}
+	if err := p.capture.Close(); err != nil {
+		slog.Error("failed to close capture file", "error", err)
+	}
 }
 
 func (p *Proxy) handleScan(w http.ResponseWriter, r *http.Request) {
@@ -59,19 +187,32 @@ func (p *Proxy) handleScan(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	result := p.scanner.Scan(string(body))
-	redacted := redactSecrets(string(body), result.Secrets)
+	result := p.scanner.Load().Scan(r.Context(), string(body), Location{})
+	redacted := redactSecrets(string(body), result.Findings)
 
 	// Generate findings for debug response
-	findings := make([]string, len(result.Secrets))
-	for i, secret := range result.Secrets {
-		findings[i] = fmt.Sprintf("Secret %d: %s", i+1, truncate(secret))
+	findings := make([]string, len(result.Findings))
+	for i, f := range result.Findings {
+		findings[i] = fmt.Sprintf("Secret %d: %s", i+1, truncate(f.Secret))
+		if len(f.Encodings) > 0 {
+			findings[i] += fmt.Sprintf(" (decoded: %s)", strings.Join(f.Encodings, " -> "))
+		}
+		if f.Detail != "" {
+			findings[i] += fmt.Sprintf(" [%s]", f.Detail)
+		}
+		if f.Confidence > 0 {
+			findings[i] += fmt.Sprintf(" confidence=%.2f", f.Confidence)
+		}
+		if f.Action == actionLog {
+			findings[i] += " (log only)"
+		}
+		findings[i] += " fingerprint=" + f.Fingerprint
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
 		"redacted": redacted,
-		"count":    len(result.Secrets),
+		"count":    len(result.Findings),
 		"findings": findings,
 	})
 }
@@ -82,6 +223,18 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		p.handleScan(w, r)
 		return
 	}
+	if r.URL.Path == "/debug/rules" {
+		p.handleRules(w, r)
+		return
+	}
+	if r.URL.Path == "/debug/rule-stats" {
+		p.handleRuleStats(w, r)
+		return
+	}
+	if r.URL.Path == "/admin/feedback" {
+		p.handleFeedback(w, r)
+		return
+	}
 
 	ctx := r.Context()
 	slog.Info("request received", "method", r.Method, "path", r.URL.Path)
@@ -93,36 +246,245 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
+	// the whole request is handled by one scanner, even if a reload swaps
+	// it; it is picked after the body is read, which can take as long as
+	// the read timeout, so the scan starts well within the drain time
+	scanner := p.scanner.Load()
+
+	// The conversation this request belongs to: its pseudonyms are reversed
+	// in the response, and its risk adds up across requests
+	var session *session
+
 	// Scan and optionally redact secrets
 	if len(body) > 0 {
+		session = scanner.sessions.Session(sessionKey(body))
+
 		// span for tracing
 		var span trace.Span
 		ctx, span = p.tracer.Start(ctx, "check_leaks",
 			trace.WithAttributes(attribute.Int("body.size", len(body))))
 
 		// should we log the secrets in the traces?
-		result := p.scanner.ScanRequestBody(body)
+		var result ScanResult
+		var redactedBody []byte
+		if p.structured {
+			var err error
+			result, redactedBody, err = scanner.ScanAndReplaceRequestBody(ctx, body, "<REDACTED_KEY>")
+			if err != nil {
+				slog.Warn("structured redaction failed, falling back to string replacement", "error", err)
+				redactedBody = []byte(redactSecrets(string(body), session.Apply(result.Findings)))
+			}
+		} else {
+			result = scanner.ScanRequestBody(ctx, body)
+			redactedBody = []byte(redactSecrets(string(body), session.Apply(result.Findings)))
+		}
+		span.SetAttributes(
+			attribute.Int("leaks.found", len(result.Findings)),
+			attribute.Bool("leaks.detected", len(result.Findings) > 0),
+		)
+		tripped := result.Honeytokens()
+		if len(tripped) > 0 {
+			p.reportHoneytokens(ctx, span, r, tripped, scanner.policy.Honeytokens.Action)
+		}
+		risk := session.AssessRisk(scanner.policy.Risk, result.Findings)
 		span.SetAttributes(
-			attribute.Int("leaks.found", len(result.Secrets)),
-			attribute.Bool("leaks.detected", len(result.Secrets) > 0),
+			attribute.Float64("risk.request", risk.Request),
+			attribute.Float64("risk.session", risk.Session),
+			attribute.Int("risk.new_findings", risk.New),
 		)
+		if risk.Exceeded {
+			p.reportRisk(ctx, span, r, risk, scanner.policy.Risk.Action)
+		}
 		span.End()
+		p.stats.Record(string(body), session.Unseen(result.Findings))
 
-		if len(result.Secrets) > 0 {
-			slog.Warn("leaks detected in request", "count", len(result.Secrets))
-			if p.rejectOnLeak {
-				http.Error(w, "Request rejected: API key leak detected", http.StatusBadRequest)
+		entry := captureEntry{
+			Time:       time.Now(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Structured: p.structured,
+			ConfigHash: scanner.gitleaks.Load().rules.Hash,
+		}
+		if err := p.capture.Record(entry, body, redactedBody, result.Findings); err != nil {
+			slog.Error("failed to capture request", "error", err)
+		}
+
+		if len(tripped) > 0 && scanner.policy.Honeytokens.Action == "reject" {
+			http.Error(w, rejectMessage("honeytoken detected", tripped), http.StatusBadRequest)
+			return
+		}
+		if risk.Exceeded && scanner.policy.Risk.Action == "reject" {
+			http.Error(w, "Request rejected: risk budget exceeded", http.StatusBadRequest)
+			return
+		}
+
+		if len(result.Findings) > 0 {
+			slog.Warn("leaks detected in request", "count", len(result.Findings))
+			if rejecting := result.Rejecting(p.rejectOnLeak); len(rejecting) > 0 {
+				http.Error(w, rejectMessage("API key leak detected", rejecting), http.StatusBadRequest)
 				return
 			}
-			body = []byte(redactSecrets(string(body), result.Secrets))
-			slog.Info("secrets redacted", "count", len(result.Secrets))
+			body = redactedBody
+			slog.Info("secrets redacted", "count", len(result.Findings))
+		}
+	}
+
+	p.forwardRequest(ctx, w, r, body, session)
+}
+
+// rejectMessage tells the client why its request was rejected, with the rule
+// and fingerprint of each finding, so a false positive can be reported
+// without digging through the proxy log.
+func rejectMessage(reason string, findings []Finding) string {
+	var b strings.Builder
+	b.WriteString("Request rejected: " + reason)
+	for _, f := range findings {
+		fmt.Fprintf(&b, "\n  rule=%s fingerprint=%s", f.RuleID, f.Fingerprint)
+	}
+	return b.String()
+}
+
+// ruleInfo describes one rule of the merged gitleaks config.
+type ruleInfo struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description,omitempty"`
+	Sources     []string `json:"sources"`
+	Keywords    []string `json:"keywords,omitempty"`
+	Entropy     float64  `json:"entropy,omitempty"`
+	Allowlists  int      `json:"allowlists,omitempty"`
+}
+
+// handleRules shows the effective gitleaks rules and the layers they came
+// from, first the one that added each rule, then any that changed it.
+func (p *Proxy) handleRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	cfg := p.scanner.Load().gitleaks.Load().rules
+	rules := make([]ruleInfo, 0, len(cfg.Config.Rules))
+	for _, rule := range cfg.Config.GetOrderedRules() {
+		rules = append(rules, ruleInfo{
+			ID:          rule.RuleID,
+			Description: rule.Description,
+			Sources:     cfg.Sources[rule.RuleID],
+			Keywords:    rule.Keywords,
+			Entropy:     rule.Entropy,
+			Allowlists:  len(rule.Allowlists),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"layers":     cfg.Layers,
+		"allowlists": len(cfg.Config.Allowlists),
+		"warnings":   cfg.Warnings,
+		"rules":      rules,
+	})
+}
+
+// handleRuleStats reports how often each rule fired since the proxy started,
+// which rules are noisy or never fire, and suggested entropy thresholds. The
+// samples show the text around secrets, so it needs the feedback token.
+func (p *Proxy) handleRuleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := p.scanner.Load().policy.Feedback.Token
+	if token == "" {
+		http.Error(w, "Rule statistics need feedback.token in the policy", http.StatusNotFound)
+		return
+	}
+	if !authorized(r, token) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	report := p.stats.Report(p.scanner.Load().gitleaks.Load().rules.Config)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// reportHoneytokens treats each tripped honeytoken as a security incident: it
+// is logged at LevelAlert, added to the span as an event and written to the
+// audit log, along with the tool call that read it.
+func (p *Proxy) reportHoneytokens(ctx context.Context, span trace.Span, r *http.Request, tripped []Finding, action string) {
+	for _, f := range tripped {
+		slog.Log(ctx, LevelAlert, "honeytoken tripped",
+			"rule", f.RuleID,
+			"action", action,
+			"block", f.Location.Block,
+			"tool_name", f.Location.ToolName,
+			"tool_use_id", f.Location.ToolUseID,
+			"target", f.Location.Target,
+		)
+
+		span.AddEvent("honeytoken.tripped", trace.WithAttributes(
+			attribute.String("honeytoken.rule", f.RuleID),
+			attribute.String("honeytoken.action", action),
+			attribute.String("honeytoken.block", f.Location.Block),
+			attribute.String("honeytoken.tool_name", f.Location.ToolName),
+			attribute.String("honeytoken.target", f.Location.Target),
+		))
+
+		err := p.audit.Record(auditEntry{
+			Time:      time.Now().UTC(),
+			Event:     "honeytoken",
+			Rule:      f.RuleID,
+			Action:    action,
+			Secret:    truncate(f.Secret),
+			Block:     f.Location.Block,
+			ToolName:  f.Location.ToolName,
+			ToolUseID: f.Location.ToolUseID,
+			Target:    f.Location.Target,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Remote:    r.RemoteAddr,
+			TraceID:   span.SpanContext().TraceID().String(),
+		})
+		if err != nil {
+			slog.Error("failed to write audit log", "error", err)
 		}
 	}
+}
+
+// reportRisk records a request that took its request or session over the
+// risk budget. No single finding may be serious on its own, so the scores are
+// reported rather than the secrets.
+func (p *Proxy) reportRisk(ctx context.Context, span trace.Span, r *http.Request, risk riskAssessment, action string) {
+	slog.Log(ctx, LevelAlert, "risk budget exceeded",
+		"request_risk", risk.Request,
+		"session_risk", risk.Session,
+		"action", action,
+	)
+
+	span.AddEvent("risk.exceeded", trace.WithAttributes(
+		attribute.Float64("risk.request", risk.Request),
+		attribute.Float64("risk.session", risk.Session),
+		attribute.String("risk.action", action),
+	))
 
-	p.forwardRequest(ctx, w, r, body)
+	err := p.audit.Record(auditEntry{
+		Time:    time.Now().UTC(),
+		Event:   "risk",
+		Action:  action,
+		Score:   risk.Session,
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Remote:  r.RemoteAddr,
+		TraceID: span.SpanContext().TraceID().String(),
+	})
+	if err != nil {
+		slog.Error("failed to write audit log", "error", err)
+	}
 }
 
-func (p *Proxy) forwardRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, body []byte) {
+// forwardRequest sends the request upstream and copies the response back. If
+// session has pseudonyms, they are mapped back to the real identifiers in the
+// response so tool calls the model makes still reach the real hosts.
+func (p *Proxy) forwardRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, body []byte, session *session) {
 	target := *p.upstream
 	target.Path = r.URL.Path
 	target.RawQuery = r.URL.RawQuery
@@ -133,7 +495,14 @@ func (p *Proxy) forwardRequest(ctx context.Context, w http.ResponseWriter, r *ht
 		return
 	}
 
-	copyHeaders(req.Header, r.Header, "host", "content-length")
+	reverse := session != nil && !session.Empty()
+	if reverse {
+		// let the transport negotiate and undo compression, so the body
+		// can be rewritten
+		copyHeaders(req.Header, r.Header, "host", "content-length", "accept-encoding")
+	} else {
+		copyHeaders(req.Header, r.Header, "host", "content-length")
+	}
 
 	resp, err := p.client.Do(req)
 	if err != nil {
@@ -142,9 +511,43 @@ func (p *Proxy) forwardRequest(ctx context.Context, w http.ResponseWriter, r *ht
 	}
 	defer resp.Body.Close()
 
-	copyHeaders(w.Header(), resp.Header)
+	if !reverse {
+		copyHeaders(w.Header(), resp.Header)
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	copyHeaders(w.Header(), resp.Header, "content-length")
 	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	if err := copyReversed(w, resp.Body, session); err != nil {
+		slog.Warn("failed to copy upstream response", "error", err)
+	}
+}
+
+// copyReversed copies an upstream response line by line, reversing
+// pseudonyms. Each server-sent event is flushed as soon as it is complete.
+// A pseudonym split across two streamed text deltas is not reversed.
+func copyReversed(w http.ResponseWriter, body io.Reader, session *session) error {
+	flusher, _ := w.(http.Flusher)
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if _, werr := io.WriteString(w, session.Reverse(line)); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
 }
 
 // copyHeaders copies headers from src to dst, excluding specified keys.
@@ -163,9 +566,6 @@ func copyHeaders(dst, src http.Header, exclude ...string) {
 	}
 }
 
-func redactSecrets(text string, secrets []string) string {
-	for _, secret := range secrets {
-		text = strings.ReplaceAll(text, secret, "<REDACTED_KEY>")
-	}
-	return text
+func redactSecrets(text string, findings []Finding) string {
+	return redact(text, findings, "<REDACTED_KEY>")
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRejectMessage(t *testing.T) {
+	findings := []Finding{
+		{RuleID: "github-pat", Fingerprint: "github-pat:d2769a1456968a0c"},
+		{RuleID: "acme-token", Fingerprint: ".env:acme-token:5f0c2ab1e4d3c9a7"},
+	}
+	msg := rejectMessage("API key leak detected", findings)
+	if !strings.HasPrefix(msg, "Request rejected: API key leak detected\n") {
+		t.Errorf("message = %q", msg)
+	}
+	for _, f := range findings {
+		if !strings.Contains(msg, "rule="+f.RuleID+" fingerprint="+f.Fingerprint) {
+			t.Errorf("message %q is missing %s", msg, f.Fingerprint)
+		}
+	}
+}
+
+func TestHandleRuleStatsToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"no token configured", "", "", http.StatusNotFound},
+		{"no token configured, any sent", "", "Bearer ", http.StatusNotFound},
+		{"missing", "change-me", "", http.StatusUnauthorized},
+		{"wrong", "change-me", "Bearer guess", http.StatusUnauthorized},
+		{"right", "change-me", "Bearer change-me", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := defaultTestPolicy(t)
+			policy.Feedback.Token = tt.token
+			p := &Proxy{stats: newRuleCounters()}
+			p.scanner.Store(newTestScanner(t, policy))
+
+			req := httptest.NewRequest(http.MethodGet, "/debug/rule-stats", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			p.handleRuleStats(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+// swapReader runs swap before its first read, as if a reload landed while
+// the request body was still arriving.
+type swapReader struct {
+	io.Reader
+	swap func()
+}
+
+func (r *swapReader) Read(b []byte) (int, error) {
+	if r.swap != nil {
+		r.swap()
+		r.swap = nil
+	}
+	return r.Reader.Read(b)
+}
+
+func TestServeHTTPScansWithScannerAfterBody(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer upstream.Close()
+
+	p, err := NewProxy(upstream.URL, false, false, nil, defaultTestPolicy(t), slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("NewProxy: %v", err)
+	}
+	defer p.Close()
+
+	// the old scanner would redact the token and forward the request
+	rejecting := defaultTestPolicy(t)
+	rejecting.Actions = map[string]string{"github-pat": actionReject}
+	next := newTestScanner(t, rejecting)
+
+	body := &swapReader{
+		Reader: strings.NewReader(`{"messages":[{"role":"user","content":"token ` + testToken + `"}]}`),
+		swap:   func() { p.scanner.Store(next) },
+	}
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", body)
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d from the scanner swapped in while the body was read", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestScannerDrainTime(t *testing.T) {
+	if scannerDrainTime <= serverReadTimeout || scannerDrainTime <= serverWriteTimeout {
+		t.Errorf("scanner drain time %s does not outlast the server timeouts", scannerDrainTime)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// defaultSessionKey is shared by requests that do not identify a session.
+const defaultSessionKey = "default"
+
+// sessionKey identifies the conversation a request belongs to. Claude Code
+// sends a per-session metadata.user_id; requests without one share a session.
+func sessionKey(body []byte) string {
+	if key := gjson.GetBytes(body, "metadata.user_id").String(); key != "" {
+		return key
+	}
+	return defaultSessionKey
+}
+
+// sessionStore holds the state of every active session.
+// Sessions idle for longer than ttl are dropped.
+type sessionStore struct {
+	ttl time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{ttl: ttl, sessions: make(map[string]*session)}
+}
+
+// SetTTL changes how long idle sessions are kept.
+func (p *sessionStore) SetTTL(ttl time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ttl = ttl
+}
+
+// Session returns the state for key, creating it if needed.
+func (p *sessionStore) Session(key string) *session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for k, s := range p.sessions {
+		if now.Sub(s.lastUsed()) > p.ttl {
+			delete(p.sessions, k)
+		}
+	}
+
+	s, ok := p.sessions[key]
+	if !ok {
+		s = &session{
+			forward:   make(map[string]string),
+			reverse:   make(map[string]string),
+			counts:    make(map[string]int),
+			riskSeen:  make(map[string]struct{}),
+			statsSeen: make(map[string]struct{}),
+		}
+		p.sessions[key] = s
+	}
+	s.touch(now)
+	return s
+}
+
+// session is what the proxy remembers about one conversation across
+// requests: the pseudonyms given to internal identifiers, so the model sees
+// the same name for the same host every time, and the accumulated risk.
+type session struct {
+	mu   sync.Mutex
+	used time.Time
+
+	forward  map[string]string // real -> pseudonym
+	reverse  map[string]string // pseudonym -> real
+	counts   map[string]int    // per pseudonym kind
+	replacer *strings.Replacer // reverse replacer, rebuilt on change
+
+	risk     float64
+	riskSeen map[string]struct{} // hashes of findings already counted
+
+	statsSeen map[string]struct{} // fingerprints already in the rule stats
+}
+
+// Unseen returns the findings whose fingerprints the session has not
+// reported to the rule statistics before, and marks them as seen. Claude
+// resends the whole conversation with every request, so without this a
+// secret would be counted again on every turn.
+func (s *session) Unseen(findings []Finding) []Finding {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var unseen []Finding
+	for _, f := range findings {
+		if _, ok := s.statsSeen[f.Fingerprint]; ok {
+			continue
+		}
+		s.statsSeen[f.Fingerprint] = struct{}{}
+		unseen = append(unseen, f)
+	}
+	return unseen
+}
+
+func (s *session) touch(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used = now
+}
+
+func (s *session) lastUsed() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionUnseen(t *testing.T) {
+	store := newSessionStore(time.Hour)
+	first := []Finding{
+		{RuleID: "github-pat", Secret: testToken, Fingerprint: "github-pat:1"},
+		{RuleID: "github-pat", Secret: testToken, Fingerprint: "github-pat:1"},
+	}
+	// the next turn resends the first finding along with a new one
+	second := append(first[:1:1], Finding{RuleID: "acme-token", Secret: "acme", Fingerprint: "acme-token:2"})
+
+	s := store.Session("a")
+	if got := s.Unseen(first); len(got) != 1 {
+		t.Errorf("first request: %d unseen, want 1", len(got))
+	}
+	got := s.Unseen(second)
+	if len(got) != 1 || got[0].Fingerprint != "acme-token:2" {
+		t.Errorf("second request: unseen = %v, want only acme-token:2", got)
+	}
+	if got := s.Unseen(second); len(got) != 0 {
+		t.Errorf("resent request: %d unseen, want 0", len(got))
+	}
+
+	// other sessions count the same finding again
+	if got := store.Session("b").Unseen(first); len(got) != 1 {
+		t.Errorf("other session: %d unseen, want 1", len(got))
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"cmp"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zricethezav/gitleaks/v8/config"
+)
+
+const (
+	// statsSamples is how many masked match contexts are kept per rule, the
+	// most recent ones.
+	statsSamples = 5
+	// statsEntropies is how many match entropies are kept per rule, sampled
+	// evenly over everything the rule matched.
+	statsEntropies = 1000
+	// likelyReal is the confidence from which a finding counts as a real
+	// secret when judging how noisy a rule is.
+	likelyReal = 0.5
+	// noisyMinCount and noisyRatio make a rule noisy: at least this many
+	// findings, at least this share of them unlikely to be real.
+	noisyMinCount = 5
+	noisyRatio    = 0.5
+)
+
+// ruleStats counts what one rule found since the proxy started.
+type ruleStats struct {
+	count int
+	// lowConfidence counts the scored findings below likelyReal.
+	lowConfidence int
+	byBlock       map[string]int
+	byTool        map[string]int
+	lastSeen      time.Time
+	// samples is a ring of masked contexts; next is where the next one goes.
+	samples []string
+	next    int
+	// entropies is a reservoir of the entropy of scored matches, seen counts
+	// every match offered to it.
+	entropies []entropySample
+	seen      int
+}
+
+type entropySample struct {
+	entropy float64
+	real    bool
+}
+
+// ruleCounters keeps per-rule statistics over the traffic the proxy scans, to
+// tell which rules are noisy, which never fire and how their entropy
+// thresholds could be tuned. Secrets are never kept, only their entropy and
+// masked contexts.
+type ruleCounters struct {
+	mu       sync.Mutex
+	since    time.Time
+	requests int
+	rules    map[string]*ruleStats
+}
+
+func newRuleCounters() *ruleCounters {
+	return &ruleCounters{since: time.Now(), rules: make(map[string]*ruleStats)}
+}
+
+// Record counts the findings of one request, which were found in text.
+func (c *ruleCounters) Record(text string, findings []Finding) {
+	masked := maskFindings(text, findings)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests++
+	now := time.Now()
+	for _, f := range findings {
+		stats, ok := c.rules[f.RuleID]
+		if !ok {
+			stats = &ruleStats{byBlock: make(map[string]int), byTool: make(map[string]int)}
+			c.rules[f.RuleID] = stats
+		}
+		stats.count++
+		stats.lastSeen = now
+		block := f.Location.Block
+		if block == "" {
+			block = "request"
+		}
+		stats.byBlock[block]++
+		if f.Location.ToolName != "" {
+			stats.byTool[f.Location.ToolName]++
+		}
+
+		if sample := matchContext(masked, maskSecret(f.Secret)); sample != "" {
+			if len(stats.samples) < statsSamples {
+				stats.samples = append(stats.samples, sample)
+			} else {
+				stats.samples[stats.next] = sample
+			}
+			stats.next = (stats.next + 1) % statsSamples
+		}
+
+		if f.Confidence == 0 {
+			continue // not scored, so neither real nor noise
+		}
+		real := f.Confidence >= likelyReal
+		if !real {
+			stats.lowConfidence++
+		}
+		sample := entropySample{entropy: shannonEntropy(f.Secret), real: real}
+		stats.seen++
+		if len(stats.entropies) < statsEntropies {
+			stats.entropies = append(stats.entropies, sample)
+		} else if i := rand.IntN(stats.seen); i < statsEntropies {
+			stats.entropies[i] = sample
+		}
+	}
+}
+
+// maskSecret is what a secret is replaced with in match contexts.
+func maskSecret(secret string) string {
+	return "<" + truncate(secret) + ">"
+}
+
+// maskFindings masks every secret found in text, log-only ones included, so
+// that a context cut around one secret cannot show another.
+func maskFindings(text string, findings []Finding) string {
+	sorted := slices.Clone(findings)
+	slices.SortStableFunc(sorted, func(a, b Finding) int { return len(b.Secret) - len(a.Secret) })
+	for _, f := range sorted {
+		if f.Secret != "" {
+			text = strings.ReplaceAll(text, f.Secret, maskSecret(f.Secret))
+		}
+	}
+	return text
+}
+
+// matchContext returns the masked secret with contextWindow bytes of masked
+// text on either side, trimmed to whole runes.
+func matchContext(masked, mask string) string {
+	i := strings.Index(masked, mask)
+	if i < 0 {
+		return ""
+	}
+	start := max(0, i-contextWindow)
+	end := min(len(masked), i+len(mask)+contextWindow)
+	for start < i && !utf8.RuneStart(masked[start]) {
+		start++
+	}
+	for end < len(masked) && !utf8.RuneStart(masked[end]) {
+		end--
+	}
+	return masked[start:end]
+}
+
+// rulesReport summarizes the rule statistics.
+type rulesReport struct {
+	Since    time.Time `json:"since"`
+	Requests int       `json:"requests"`
+	// Rules are the rules that fired, most findings first.
+	Rules []ruleReport `json:"rules"`
+	// Noisy lists the rules most of whose scored findings were unlikely to
+	// be real secrets.
+	Noisy []string `json:"noisy"`
+	// Silent lists the gitleaks rules that never fired.
+	Silent []string `json:"silent"`
+}
+
+type ruleReport struct {
+	RuleID        string         `json:"rule"`
+	Count         int            `json:"count"`
+	LowConfidence int            `json:"low_confidence"`
+	ByBlock       map[string]int `json:"by_block"`
+	ByTool        map[string]int `json:"by_tool,omitempty"`
+	LastSeen      time.Time      `json:"last_seen"`
+	Samples       []string       `json:"samples,omitempty"`
+	Entropy       *entropyReport `json:"entropy,omitempty"`
+}
+
+// entropyReport describes the entropy of a rule's matches and, when it would
+// help, suggests a threshold.
+type entropyReport struct {
+	Min    float64 `json:"min"`
+	Median float64 `json:"median"`
+	Max    float64 `json:"max"`
+	// Current is the rule's threshold in the gitleaks config, if it has one.
+	Current float64 `json:"current,omitempty"`
+	// Suggested keeps about 95% of the likely real matches. It is only given
+	// when it is above Current and drops some of the unlikely ones:
+	// WouldDrop of them, along with WouldLose likely real ones.
+	Suggested float64 `json:"suggested,omitempty"`
+	WouldDrop int     `json:"would_drop,omitempty"`
+	WouldLose int     `json:"would_lose,omitempty"`
+}
+
+// Report summarizes the statistics, listing as silent the rules of cfg that
+// never fired. Rules that never report on their own, such as the auxiliary
+// rules of composite rules, are left out.
+func (c *ruleCounters) Report(cfg config.Config) rulesReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	report := rulesReport{Since: c.since, Requests: c.requests, Rules: []ruleReport{}, Noisy: []string{}, Silent: []string{}}
+	for id, stats := range c.rules {
+		// nothing in the report may share memory with stats, since the
+		// report is encoded after the lock is released
+		rule := ruleReport{
+			RuleID:        id,
+			Count:         stats.count,
+			LowConfidence: stats.lowConfidence,
+			ByBlock:       maps.Clone(stats.byBlock),
+			ByTool:        maps.Clone(stats.byTool),
+			LastSeen:      stats.lastSeen,
+			// oldest first
+			Samples: slices.Concat(stats.samples[stats.next:], stats.samples[:stats.next]),
+			Entropy: entropyStats(stats.entropies, cfg.Rules[id].Entropy),
+		}
+		report.Rules = append(report.Rules, rule)
+		scored := stats.seen
+		if scored >= noisyMinCount && float64(stats.lowConfidence) >= noisyRatio*float64(scored) {
+			report.Noisy = append(report.Noisy, id)
+		}
+	}
+	slices.SortFunc(report.Rules, func(a, b ruleReport) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.RuleID, b.RuleID))
+	})
+	slices.Sort(report.Noisy)
+
+	for _, rule := range cfg.GetOrderedRules() {
+		if _, ok := c.rules[rule.RuleID]; !ok && !rule.SkipReport {
+			report.Silent = append(report.Silent, rule.RuleID)
+		}
+	}
+	return report
+}
+
+// entropyStats describes the sampled entropies, suggesting a threshold at
+// the 5th percentile of the likely real matches, rounded down to a tenth.
+func entropyStats(samples []entropySample, current float64) *entropyReport {
+	if len(samples) == 0 {
+		return nil
+	}
+	all := make([]float64, 0, len(samples))
+	var real, noise []float64
+	for _, s := range samples {
+		all = append(all, s.entropy)
+		if s.real {
+			real = append(real, s.entropy)
+		} else {
+			noise = append(noise, s.entropy)
+		}
+	}
+	slices.Sort(all)
+	report := &entropyReport{
+		Min:     round2(all[0]),
+		Median:  round2(all[len(all)/2]),
+		Max:     round2(all[len(all)-1]),
+		Current: current,
+	}
+
+	if len(real) < noisyMinCount || len(noise) == 0 {
+		return report
+	}
+	slices.Sort(real)
+	suggested := math.Floor(real[len(real)*5/100]*10) / 10
+	if suggested <= current {
+		return report
+	}
+	drop := 0
+	for _, e := range noise {
+		if e < suggested {
+			drop++
+		}
+	}
+	if drop == 0 {
+		return report
+	}
+	lose, _ := slices.BinarySearch(real, suggested)
+	report.Suggested, report.WouldDrop, report.WouldLose = suggested, drop, lose
+	return report
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
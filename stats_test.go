@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/zricethezav/gitleaks/v8/config"
+)
+
+func TestRuleCountersReport(t *testing.T) {
+	c := newRuleCounters()
+	text := "token " + testToken + " in a file"
+	c.Record(text, []Finding{
+		{RuleID: "github-pat", Secret: testToken, Location: Location{Block: "tool_result", ToolName: "Read"}},
+	})
+	c.Record(text, []Finding{{RuleID: "github-pat", Secret: testToken}})
+
+	cfg := config.Config{Rules: map[string]config.Rule{
+		"github-pat": {RuleID: "github-pat"},
+		"acme-token": {RuleID: "acme-token"},
+	}, OrderedRules: []string{"acme-token", "github-pat"}}
+	report := c.Report(cfg)
+	if report.Requests != 2 || len(report.Rules) != 1 {
+		t.Fatalf("report = %+v, want 2 requests and one rule", report)
+	}
+	rule := report.Rules[0]
+	if rule.Count != 2 || rule.ByBlock["tool_result"] != 1 || rule.ByBlock["request"] != 1 || rule.ByTool["Read"] != 1 {
+		t.Errorf("rule = %+v", rule)
+	}
+	if len(report.Silent) != 1 || report.Silent[0] != "acme-token" {
+		t.Errorf("silent = %v, want acme-token", report.Silent)
+	}
+
+	// the report is a snapshot
+	c.Record(text, []Finding{{RuleID: "github-pat", Secret: testToken, Location: Location{Block: "tool_result", ToolName: "Read"}}})
+	if rule.ByBlock["tool_result"] != 1 || rule.ByTool["Read"] != 1 {
+		t.Errorf("report changed after it was made: %+v", rule)
+	}
+}
+
+// Run with -race: encoding a report must not read maps Record is writing.
+func TestRuleCountersConcurrentReport(t *testing.T) {
+	c := newRuleCounters()
+	cfg := config.Config{}
+	finding := Finding{RuleID: "github-pat", Secret: testToken, Location: Location{Block: "tool_result", ToolName: "Read"}}
+	c.Record(testToken, []Finding{finding})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range 200 {
+			f := finding
+			f.Location.ToolName = string(rune('A' + i%26))
+			c.Record(testToken, []Finding{f})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 200 {
+			if err := json.NewEncoder(io.Discard).Encode(c.Report(cfg)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
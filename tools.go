@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// toolRule is a compiled ToolPolicy.
+type toolRule struct {
+	policy     ToolPolicy
+	commands   []*regexp.Regexp
+	inspectors []Inspector
+}
+
+// newToolRules compiles the tool policies, resolving their extra inspectors
+// from available.
+func (s *Scanner) newToolRules(policies []ToolPolicy, available map[string]Inspector) ([]*toolRule, error) {
+	var rules []*toolRule
+	for i, policy := range policies {
+		if policy.Name == "" {
+			return nil, fmt.Errorf("tools[%d] needs a name", i)
+		}
+		rule := &toolRule{policy: policy}
+		for _, pattern := range policy.Commands {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("compile tools[%d] command pattern %q: %w", i, pattern, err)
+			}
+			rule.commands = append(rule.commands, re)
+		}
+		inspectors, err := s.resolveInspectors(available, policy.Inspectors, fmt.Sprintf("tools[%d].inspectors", i))
+		if err != nil {
+			return nil, err
+		}
+		rule.inspectors = inspectors
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// toolOnly reports whether a plugin is listed by a tool policy, in which case
+// it only runs for that tool's calls.
+func toolOnly(policies []ToolPolicy, name string) bool {
+	for _, policy := range policies {
+		if slices.Contains(policy.Inspectors, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// toolRuleFor returns the first tool rule matching the tool call behind loc,
+// or nil.
+func (s *Scanner) toolRuleFor(loc Location) *toolRule {
+	if loc.ToolName == "" {
+		return nil
+	}
+	for _, rule := range s.tools {
+		if rule.policy.Name != loc.ToolName {
+			continue
+		}
+		if len(rule.commands) == 0 {
+			return rule
+		}
+		for _, re := range rule.commands {
+			if re.MatchString(loc.Target) {
+				return rule
+			}
+		}
+	}
+	return nil
+}
+
+// maxDepth returns how many encodings deep to decode for this tool.
+func (t *toolRule) maxDepth(defaultDepth int) int {
+	if t == nil || t.policy.MaxDepth == nil {
+		return defaultDepth
+	}
+	return *t.policy.MaxDepth
+}
+
+// apply narrows findings to the tool's rule set and sets its actions. A rule
+// the tool has an action for takes it; other findings without an action take
+// the tool's default. Registered secrets and honeytokens are always kept.
+func (t *toolRule) apply(findings []Finding) []Finding {
+	if t == nil {
+		return findings
+	}
+	findings = slices.DeleteFunc(findings, func(f Finding) bool {
+		if strings.HasPrefix(f.RuleID, knownSecretRuleID+":") || strings.HasPrefix(f.RuleID, honeytokenRuleID+":") {
+			return false
+		}
+		if len(t.policy.Rules) > 0 && !containsRule(t.policy.Rules, f.RuleID) {
+			return true
+		}
+		return containsRule(t.policy.SkipRules, f.RuleID)
+	})
+	for i, f := range findings {
+		if action, ok := lookupRule(t.policy.Actions, f.RuleID); ok {
+			findings[i].Action = action
+		} else if f.Action == "" {
+			findings[i].Action = t.policy.Action
+		}
+	}
+	return findings
+}
+
+// containsRule reports whether ruleID, or its registry prefix, is in rules.
+func containsRule(rules []string, ruleID string) bool {
+	prefix, _, _ := strings.Cut(ruleID, ":")
+	return slices.ContainsFunc(rules, func(rule string) bool {
+		return strings.EqualFold(rule, ruleID) || strings.EqualFold(rule, prefix)
+	})
+}
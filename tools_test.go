@@ -0,0 +1,109 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestToolRuleFor(t *testing.T) {
+	s := newTestScanner(t, defaultTestPolicy(t))
+	tools, err := s.newToolRules([]ToolPolicy{
+		{Name: "Bash", Commands: []string{`^(env|printenv)\b`, `kubectl get secrets?\b`}, Action: actionReject},
+		{Name: "Bash", Action: actionLog},
+		{Name: "Grep", SkipRules: []string{"generic-api-key"}},
+	}, s.availableInspectors(nil))
+	if err != nil {
+		t.Fatalf("newToolRules: %v", err)
+	}
+	s.tools = tools
+
+	tests := []struct {
+		loc  Location
+		want *toolRule
+	}{
+		{Location{ToolName: "Bash", Target: "env"}, tools[0]},
+		{Location{ToolName: "Bash", Target: "kubectl get secret db -o yaml"}, tools[0]},
+		{Location{ToolName: "Bash", Target: "ls -la"}, tools[1]},
+		{Location{ToolName: "Grep", Target: "password"}, tools[2]},
+		{Location{ToolName: "Read", Target: "/repo/.env"}, nil},
+		{Location{Block: "text"}, nil},
+	}
+	for _, tt := range tests {
+		if got := s.toolRuleFor(tt.loc); got != tt.want {
+			t.Errorf("toolRuleFor(%+v) = %+v, want %+v", tt.loc, got, tt.want)
+		}
+	}
+
+	if _, err := s.newToolRules([]ToolPolicy{{Name: "Bash", Commands: []string{"("}}}, nil); err == nil {
+		t.Error("newToolRules accepted an invalid command pattern")
+	}
+	if _, err := s.newToolRules([]ToolPolicy{{Name: "Bash", Inspectors: []string{"no-such"}}}, s.availableInspectors(nil)); err == nil {
+		t.Error("newToolRules accepted an unknown inspector")
+	}
+}
+
+func TestToolRuleApply(t *testing.T) {
+	depth := 1
+	rule := &toolRule{policy: ToolPolicy{
+		MaxDepth:  &depth,
+		Rules:     []string{"github-pat", "aws-access-token", "generic-api-key"},
+		SkipRules: []string{"generic-api-key"},
+		Action:    actionReject,
+		Actions:   map[string]string{"aws-access-token": actionLog},
+	}}
+	findings := rule.apply([]Finding{
+		{RuleID: "github-pat"},
+		{RuleID: "aws-access-token"},
+		{RuleID: "generic-api-key"},
+		{RuleID: "slack-bot-token"},
+		{RuleID: "pii-email", Action: actionRedact},
+		{RuleID: knownSecretRuleID + ":DB_PASSWORD", Action: actionRedact},
+	})
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.RuleID+"="+f.Action)
+	}
+	// only the listed rules, minus the skipped ones; registered secrets are
+	// always kept, with their own action
+	want := []string{"github-pat=reject", "aws-access-token=log", knownSecretRuleID + ":DB_PASSWORD=redact"}
+	if !slices.Equal(got, want) {
+		t.Errorf("apply = %v, want %v", got, want)
+	}
+
+	if got := rule.maxDepth(5); got != 1 {
+		t.Errorf("maxDepth = %d, want the tool's 1", got)
+	}
+	var none *toolRule
+	if got := none.maxDepth(5); got != 5 {
+		t.Errorf("maxDepth without a tool rule = %d, want 5", got)
+	}
+	if got := none.apply([]Finding{{RuleID: "github-pat"}}); len(got) != 1 || got[0].Action != "" {
+		t.Errorf("apply without a tool rule = %+v", got)
+	}
+}
+
+func TestScanAndReplaceRequestBodyToolPolicy(t *testing.T) {
+	policy := defaultTestPolicy(t)
+	policy.Tools = []ToolPolicy{{Name: "Bash", Commands: []string{`^env\b`}, Action: actionReject}}
+	scanner := newTestScanner(t, policy)
+
+	body := `{"messages":[` +
+		`{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"Bash","input":{"command":"env"}},{"type":"tool_use","id":"t2","name":"Grep","input":{"pattern":"TOKEN"}}]},` +
+		`{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"GITHUB_TOKEN=` + testToken + `"},{"type":"tool_result","tool_use_id":"t2","content":"src/a.go: token := \"` + testToken + `x\""}]}]}`
+	result, _, err := scanner.ScanAndReplaceRequestBody(t.Context(), []byte(body), "<REDACTED_KEY>")
+	if err != nil {
+		t.Fatalf("ScanAndReplaceRequestBody: %v", err)
+	}
+	actions := make(map[string]string)
+	for _, f := range result.Findings {
+		if f.RuleID == "github-pat" {
+			actions[f.Location.ToolName] = f.Action
+		}
+	}
+	if actions["Bash"] != actionReject {
+		t.Errorf("Bash env result action = %q, want reject", actions["Bash"])
+	}
+	if action, ok := actions["Grep"]; !ok || action != "" {
+		t.Errorf("Grep result action = %q (found %v), want the default", action, ok)
+	}
+}